@@ -14,6 +14,16 @@ type Buffer struct {
 	cacheDocument   *Document
 	preferredColumn int // Remember the original column for the next up/down movement.
 	lastKeyStroke   Key
+
+	// history is the prompt history used by the history key bindings,
+	// nil if the buffer is not attached to a prompt.
+	history *History
+	// tokenizer splits the text into the words for the word motions,
+	// the words are separated by blanks if it is nil.
+	tokenizer Tokenizer
+	// acceptAndGetNext is true if a key binding requested to accept the input
+	// and to load the history entry next to the current one after that.
+	acceptAndGetNext bool
 }
 
 // Text returns string of the current line.
@@ -79,6 +89,13 @@ func (b *Buffer) setText(v string) {
 	b.workingLines[b.workingIndex] = v
 }
 
+// replaceText replaces the text and moves the cursor to its end.
+func (b *Buffer) replaceText(v string) {
+	b.setCursorPosition(0)
+	b.setText(v)
+	b.setCursorPosition(len([]rune(b.Text())))
+}
+
 // Set cursor position. Return whether it changed.
 func (b *Buffer) setCursorPosition(p int) {
 	if p > 0 {
@@ -0,0 +1,349 @@
+package completer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	prompt "github.com/tarantool/go-prompt"
+)
+
+// CommandTree is a completer for commands with subcommands, flags and
+// positional arguments. It suggests the subcommands, the flags, which are
+// not used yet, and the values of the flags and the arguments for the word
+// before the cursor. Parse checks a full line with the same rules.
+type CommandTree struct {
+	Commands   []*Command
+	IgnoreCase bool
+}
+
+// Command describes a command or a subcommand.
+type Command struct {
+	Name        string
+	Description string
+	Subcommands []*Command
+	Flags       []*Flag
+	// Args are the positional arguments after the subcommands.
+	Args []*Arg
+}
+
+// Flag describes a flag of a command used as "--long" or "-s". The value
+// follows the flag as the next word or after '=': "--long=value".
+type Flag struct {
+	Long        string
+	Short       string
+	Description string
+	// HasValue is true if the flag takes a value.
+	HasValue bool
+	// Values completes the value, the document contains only the value.
+	Values prompt.Completer
+	// Repeatable is true if the flag may be used several times.
+	Repeatable bool
+}
+
+// Arg describes a positional argument.
+type Arg struct {
+	Name        string
+	Description string
+	// Values completes the argument, the document contains only the argument.
+	Values   prompt.Completer
+	Required bool
+	// Variadic is true if the argument takes all the remaining words.
+	// It must be the last one.
+	Variadic bool
+}
+
+// ParsedLine is a line parsed by the CommandTree.
+type ParsedLine struct {
+	// Commands are the command and its subcommands.
+	Commands []*Command
+	// Flags are the values of the used flags by their long names or short
+	// names if there are no long ones. A flag without a value has an empty
+	// value for each use.
+	Flags map[string][]string
+	// Args are the positional arguments.
+	Args []string
+}
+
+// Command returns the last subcommand of the line, nil if there is no
+// command.
+func (l *ParsedLine) Command() *Command {
+	if len(l.Commands) == 0 {
+		return nil
+	}
+	return l.Commands[len(l.Commands)-1]
+}
+
+// Complete returns suggestions for the word before the cursor.
+func (t *CommandTree) Complete(d prompt.Document) []prompt.Suggest {
+	words, current := splitCommandLine(d.TextBeforeCursor())
+	p := commandParser{tree: t}
+	for _, w := range words {
+		if err := p.next(w); err != nil {
+			return nil
+		}
+	}
+
+	if p.value != nil {
+		return completeValue(p.value.Values, current, "")
+	}
+	cmd := p.line.Command()
+	if cmd == nil {
+		return prompt.FilterHasPrefix(commandSuggestions(t.Commands), current, t.IgnoreCase)
+	}
+	if strings.HasPrefix(current, "-") && !p.onlyArgs {
+		if i := strings.IndexByte(current, '='); i != -1 {
+			if f := cmd.flag(current[:i]); f != nil && f.HasValue {
+				return completeValue(f.Values, current[i+1:], current[:i+1])
+			}
+			return nil
+		}
+		return prompt.FilterHasPrefix(p.flagSuggestions(), current, t.IgnoreCase)
+	}
+
+	var suggests []prompt.Suggest
+	if len(p.line.Args) == 0 {
+		suggests = commandSuggestions(cmd.Subcommands)
+	}
+	if arg := p.arg(); arg != nil {
+		suggests = append(
+			prompt.FilterHasPrefix(suggests, current, t.IgnoreCase),
+			completeValue(arg.Values, current, "")...)
+		return suggests
+	}
+	if len(suggests) == 0 && current == "" && !p.onlyArgs {
+		// Nothing else is expected, show the flags.
+		return p.flagSuggestions()
+	}
+	return prompt.FilterHasPrefix(suggests, current, t.IgnoreCase)
+}
+
+// Parse parses the line and checks the commands, the flags and the number
+// of the positional arguments. A command with subcommands and without
+// arguments requires a subcommand.
+func (t *CommandTree) Parse(line string) (*ParsedLine, error) {
+	words, current := splitCommandLine(line)
+	if current != "" {
+		words = append(words, current)
+	}
+	p := commandParser{tree: t}
+	for _, w := range words {
+		if err := p.next(w); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := p.line.Command()
+	switch {
+	case cmd == nil:
+		return nil, fmt.Errorf("command is expected")
+	case p.value != nil:
+		return nil, fmt.Errorf("%s: value is expected", p.valueFlag)
+	case len(cmd.Subcommands) > 0 && len(cmd.Args) == 0:
+		return nil, fmt.Errorf("%s: subcommand is expected", cmd.Name)
+	}
+	for i := len(p.line.Args); i < len(cmd.Args); i++ {
+		if cmd.Args[i].Required {
+			return nil, fmt.Errorf("%s: argument %s is expected", cmd.Name, cmd.Args[i].Name)
+		}
+	}
+	return &p.line, nil
+}
+
+// commandParser contains the state of the parsing of a command line.
+type commandParser struct {
+	tree *CommandTree
+	line ParsedLine
+	// value is the flag waiting for the value in the next word,
+	// valueFlag is the word with it.
+	value     *Flag
+	valueFlag string
+	// onlyArgs is true after "--".
+	onlyArgs bool
+}
+
+// next parses the next word.
+func (p *commandParser) next(word string) error {
+	cmd := p.line.Command()
+	switch {
+	case p.value != nil:
+		p.addFlag(p.value, word)
+		p.value = nil
+	case cmd == nil:
+		c := findCommand(p.tree.Commands, word, p.tree.IgnoreCase)
+		if c == nil {
+			return fmt.Errorf("%s: unknown command", word)
+		}
+		p.line.Commands = append(p.line.Commands, c)
+		p.line.Flags = map[string][]string{}
+	case word == "--" && !p.onlyArgs:
+		p.onlyArgs = true
+	case isFlag(word) && !p.onlyArgs:
+		return p.flag(cmd, word)
+	default:
+		if len(p.line.Args) == 0 {
+			if c := findCommand(cmd.Subcommands, word, p.tree.IgnoreCase); c != nil {
+				p.line.Commands = append(p.line.Commands, c)
+				return nil
+			}
+		}
+		if p.arg() == nil {
+			if len(cmd.Subcommands) > 0 && len(p.line.Args) == 0 {
+				return fmt.Errorf("%s: unknown subcommand", word)
+			}
+			return fmt.Errorf("%s: unexpected argument", word)
+		}
+		p.line.Args = append(p.line.Args, word)
+	}
+	return nil
+}
+
+// flag parses the flag word of the command.
+func (p *commandParser) flag(cmd *Command, word string) error {
+	name, value, hasValue := word, "", false
+	if i := strings.IndexByte(word, '='); i != -1 {
+		name, value, hasValue = word[:i], word[i+1:], true
+	}
+	f := cmd.flag(name)
+	switch {
+	case f == nil:
+		return fmt.Errorf("%s: unknown flag", name)
+	case !f.Repeatable && p.used(f):
+		return fmt.Errorf("%s: flag is already used", name)
+	case hasValue && !f.HasValue:
+		return fmt.Errorf("%s: flag does not take a value", name)
+	case f.HasValue && !hasValue:
+		p.value, p.valueFlag = f, name
+	default:
+		p.addFlag(f, value)
+	}
+	return nil
+}
+
+// addFlag adds the value of the flag to the line.
+func (p *commandParser) addFlag(f *Flag, value string) {
+	name := f.Long
+	if name == "" {
+		name = f.Short
+	}
+	p.line.Flags[name] = append(p.line.Flags[name], value)
+}
+
+// used returns true if the flag is already used in the line.
+func (p *commandParser) used(f *Flag) bool {
+	name := f.Long
+	if name == "" {
+		name = f.Short
+	}
+	_, ok := p.line.Flags[name]
+	return ok || p.value == f
+}
+
+// arg returns the description of the next positional argument, nil if
+// no more arguments are expected.
+func (p *commandParser) arg() *Arg {
+	args := p.line.Command().Args
+	if n := len(p.line.Args); n < len(args) {
+		return args[n]
+	}
+	if len(args) > 0 && args[len(args)-1].Variadic {
+		return args[len(args)-1]
+	}
+	return nil
+}
+
+// flagSuggestions returns the flags of the command, which may be used.
+func (p *commandParser) flagSuggestions() []prompt.Suggest {
+	var suggests []prompt.Suggest
+	for _, f := range p.line.Command().Flags {
+		if !f.Repeatable && p.used(f) {
+			continue
+		}
+		if f.Long != "" {
+			suggests = append(suggests, prompt.Suggest{
+				Text:        "--" + f.Long,
+				Description: f.Description,
+			})
+		}
+		if f.Short != "" {
+			suggests = append(suggests, prompt.Suggest{
+				Text:        "-" + f.Short,
+				Description: f.Description,
+			})
+		}
+	}
+	return suggests
+}
+
+// flag returns the flag of the command by the word "--long" or "-s",
+// nil if there is no such flag.
+func (c *Command) flag(word string) *Flag {
+	for _, f := range c.Flags {
+		if (f.Long != "" && word == "--"+f.Long) || (f.Short != "" && word == "-"+f.Short) {
+			return f
+		}
+	}
+	return nil
+}
+
+// findCommand returns the command with the name, nil if there is no such
+// command.
+func findCommand(commands []*Command, name string, ignoreCase bool) *Command {
+	for _, c := range commands {
+		if c.Name == name || (ignoreCase && strings.EqualFold(c.Name, name)) {
+			return c
+		}
+	}
+	return nil
+}
+
+// commandSuggestions returns the suggestions of the commands.
+func commandSuggestions(commands []*Command) []prompt.Suggest {
+	suggests := make([]prompt.Suggest, 0, len(commands))
+	for _, c := range commands {
+		suggests = append(suggests, prompt.Suggest{Text: c.Name, Description: c.Description})
+	}
+	return suggests
+}
+
+// completeValue returns the suggestions of the completer for the value.
+// The prefix is prepended to the inserted texts, but it is not shown.
+func completeValue(completer prompt.Completer, value, prefix string) []prompt.Suggest {
+	if completer == nil {
+		return nil
+	}
+	buf := prompt.NewBuffer()
+	buf.InsertText(value, false, true)
+	suggests := completer(*buf.Document())
+	if prefix == "" {
+		return suggests
+	}
+	for i, s := range suggests {
+		if s.Display == "" {
+			suggests[i].Display = s.Text
+		}
+		suggests[i].Text = prefix + s.Text
+	}
+	return suggests
+}
+
+// isFlag returns true if the word looks like a flag.
+func isFlag(word string) bool {
+	return len(word) > 1 && word[0] == '-'
+}
+
+// splitCommandLine splits the text into the words separated by blanks and
+// the current word after the last blank with prompt.ShellTokenizer. The
+// quotes are removed, quoted strings and escaped blanks do not separate words.
+func splitCommandLine(text string) (words []string, current string) {
+	tokens := prompt.ShellTokenizer{}.Tokenize(text)
+	n := len(tokens)
+	if n > 0 && tokens[n-1].End == utf8.RuneCountInString(text) {
+		current = tokens[n-1].Value
+		n--
+	}
+	for _, token := range tokens[:n] {
+		words = append(words, token.Value)
+	}
+	return words, current
+}
@@ -0,0 +1,133 @@
+package completer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	prompt "github.com/tarantool/go-prompt"
+)
+
+func newTestCommandTree() *CommandTree {
+	instances := func(d prompt.Document) []prompt.Suggest {
+		return prompt.FilterHasPrefix([]prompt.Suggest{
+			{Text: "router"},
+			{Text: "storage"},
+		}, d.GetWordBeforeCursor(), false)
+	}
+	return &CommandTree{Commands: []*Command{
+		{
+			Name:        "connect",
+			Description: "Connect to an instance",
+			Flags: []*Flag{
+				{Long: "user", Short: "u", HasValue: true, Description: "User name"},
+				{Long: "verbose", Short: "v", Repeatable: true},
+				{Long: "format", HasValue: true, Values: func(d prompt.Document) []prompt.Suggest {
+					return prompt.FilterHasPrefix([]prompt.Suggest{{Text: "lua"}, {Text: "yaml"}},
+						d.GetWordBeforeCursor(), false)
+				}},
+			},
+			Args: []*Arg{{Name: "instance", Required: true, Values: instances}},
+		},
+		{
+			Name: "cluster",
+			Subcommands: []*Command{
+				{Name: "start", Args: []*Arg{{Name: "instances", Variadic: true, Values: instances}}},
+				{Name: "status", Flags: []*Flag{{Long: "all"}}},
+			},
+		},
+	}}
+}
+
+func newTestDocument(text string) prompt.Document {
+	buf := prompt.NewBuffer()
+	buf.InsertText(text, false, true)
+	return *buf.Document()
+}
+
+func suggestTexts(suggests []prompt.Suggest) []string {
+	texts := []string{}
+	for _, s := range suggests {
+		texts = append(texts, s.Text)
+	}
+	return texts
+}
+
+func TestCommandTreeComplete(t *testing.T) {
+	tree := newTestCommandTree()
+	scenarioTable := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "", expected: []string{"connect", "cluster"}},
+		{text: "cl", expected: []string{"cluster"}},
+		{text: "unknown ", expected: []string{}},
+		{text: "cluster ", expected: []string{"start", "status"}},
+		{text: "cluster st", expected: []string{"start", "status"}},
+		{text: "cluster start r", expected: []string{"router"}},
+		{text: "cluster start router s", expected: []string{"storage"}},
+		{text: "cluster status ", expected: []string{"--all"}},
+		{text: "connect -", expected: []string{"--user", "-u", "--verbose", "-v", "--format"}},
+		{text: "connect --user admin -", expected: []string{"--verbose", "-v", "--format"}},
+		{text: "connect -v -", expected: []string{"--user", "-u", "--verbose", "-v", "--format"}},
+		{text: "connect --format ", expected: []string{"lua", "yaml"}},
+		{text: "connect --format=y", expected: []string{"--format=yaml"}},
+		{text: "connect --user=admin r", expected: []string{"router"}},
+		{text: "connect router ", expected: []string{"--user", "-u", "--verbose", "-v", "--format"}},
+		{text: "connect -- -", expected: []string{}},
+	}
+
+	for _, s := range scenarioTable {
+		t.Run(s.text, func(t *testing.T) {
+			actual := tree.Complete(newTestDocument(s.text))
+			assert.Equal(t, s.expected, suggestTexts(actual))
+		})
+	}
+
+	// The value is shown without the flag.
+	actual := tree.Complete(newTestDocument("connect --format=l"))
+	require.Len(t, actual, 1)
+	assert.Equal(t, "lua", actual[0].Display)
+}
+
+func TestCommandTreeParse(t *testing.T) {
+	tree := newTestCommandTree()
+
+	line, err := tree.Parse(`connect -u "admin user" -v --verbose --format=lua router`)
+	require.NoError(t, err)
+	assert.Equal(t, "connect", line.Command().Name)
+	assert.Equal(t, map[string][]string{
+		"user":    {"admin user"},
+		"verbose": {"", ""},
+		"format":  {"lua"},
+	}, line.Flags)
+	assert.Equal(t, []string{"router"}, line.Args)
+
+	line, err = tree.Parse("cluster start router storage")
+	require.NoError(t, err)
+	require.Len(t, line.Commands, 2)
+	assert.Equal(t, "start", line.Command().Name)
+	assert.Equal(t, []string{"router", "storage"}, line.Args)
+
+	errorTable := []struct {
+		line string
+		err  string
+	}{
+		{line: "", err: "command is expected"},
+		{line: "disconnect", err: "disconnect: unknown command"},
+		{line: "cluster", err: "cluster: subcommand is expected"},
+		{line: "cluster stop", err: "stop: unknown subcommand"},
+		{line: "cluster status x", err: "x: unexpected argument"},
+		{line: "connect", err: "connect: argument instance is expected"},
+		{line: "connect --user", err: "--user: value is expected"},
+		{line: "connect -u a --user b router", err: "--user: flag is already used"},
+		{line: "connect --password router", err: "--password: unknown flag"},
+		{line: "connect --verbose=1 router", err: "--verbose: flag does not take a value"},
+	}
+	for _, s := range errorTable {
+		t.Run(s.line, func(t *testing.T) {
+			_, err := tree.Parse(s.line)
+			assert.EqualError(t, err, s.err)
+		})
+	}
+}
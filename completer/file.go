@@ -1,11 +1,14 @@
 package completer
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	prompt "github.com/tarantool/go-prompt"
 	"github.com/tarantool/go-prompt/internal/debug"
@@ -19,11 +22,33 @@ var (
 // FilePathCompleter is a completer for your local file system.
 // Please caution that you need to set
 // OptionCompletionWordSeparator(completer.FilePathCompletionSeparator)
-// when you use this completer.
+// when you use this completer without Tokenizer.
 type FilePathCompleter struct {
-	Filter        func(fi os.FileInfo) bool
-	IgnoreCase    bool
-	fileListCache map[string][]prompt.Suggest
+	Filter     func(fi os.FileInfo) bool
+	IgnoreCase bool
+	// HideDotFiles hides the names starting with a dot unless the completed
+	// name starts with it.
+	HideDotFiles bool
+	// Extensions are the extensions of the suggested files like ".go",
+	// all the files are suggested if it is empty. Directories are always
+	// suggested.
+	Extensions []string
+	// Tokenizer finds the path before the cursor, which may be quoted or
+	// contain escaped characters, if it is not nil. The suggestions contain
+	// the whole path then, so they are quoted like the path by the prompt
+	// with the same prompt.OptionTokenizer.
+	Tokenizer prompt.Tokenizer
+	// Describe returns the description of a file, for example FileSize
+	// or FileType. There are no descriptions if it is nil.
+	Describe func(fi os.FileInfo) string
+
+	fileListCache map[string]fileList
+}
+
+// fileList is the cached content of a directory.
+type fileList struct {
+	modTime time.Time
+	files   []os.FileInfo
 }
 
 func cleanFilePath(path string) (dir, base string, err error) {
@@ -31,6 +56,7 @@ func cleanFilePath(path string) (dir, base string, err error) {
 		return ".", "", nil
 	}
 
+	rawPath := path
 	var endsWithSeparator bool
 	if len(path) >= 1 && path[len(path)-1] == os.PathSeparator {
 		endsWithSeparator = true
@@ -51,27 +77,33 @@ func cleanFilePath(path string) (dir, base string, err error) {
 		dir = path + string(os.PathSeparator) // Append slash(in POSIX) if path ends with slash.
 		base = ""                             // Set empty string if path ends with separator.
 	}
+	if filepath.Base(rawPath) == "." && !endsWithSeparator {
+		// Clean removes the dot, which starts the names of the dotfiles.
+		dir, base = path+string(os.PathSeparator), "."
+	}
 	return dir, base, nil
 }
 
-// Complete returns suggestions from your local file system.
+// Complete returns suggestions from your local file system. Directories
+// are suggested with the trailing separator, so the completion may continue
+// into them. The content of a directory is cached until its modification
+// time changes.
 func (c *FilePathCompleter) Complete(d prompt.Document) []prompt.Suggest {
 	if c.fileListCache == nil {
-		c.fileListCache = make(map[string][]prompt.Suggest, 4)
+		c.fileListCache = make(map[string]fileList, 4)
 	}
 
 	path := d.GetWordBeforeCursor()
+	if c.Tokenizer != nil {
+		path = d.GetTokenBeforeCursor(c.Tokenizer).Value
+	}
 	dir, base, err := cleanFilePath(path)
 	if err != nil {
 		debug.Log("completer: cannot get current user:" + err.Error())
 		return nil
 	}
 
-	if cached, ok := c.fileListCache[dir]; ok {
-		return prompt.FilterHasPrefix(cached, base, c.IgnoreCase)
-	}
-
-	files, err := ioutil.ReadDir(dir)
+	files, err := c.readDir(dir)
 	if err != nil && os.IsNotExist(err) {
 		return nil
 	} else if err != nil {
@@ -84,8 +116,113 @@ func (c *FilePathCompleter) Complete(d prompt.Document) []prompt.Suggest {
 		if c.Filter != nil && !c.Filter(f) {
 			continue
 		}
-		suggests = append(suggests, prompt.Suggest{Text: f.Name()})
+		if c.HideDotFiles && strings.HasPrefix(f.Name(), ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		isDir := isDirectory(dir, f)
+		if !isDir && !c.hasExtension(f.Name()) {
+			continue
+		}
+		s := prompt.Suggest{Text: f.Name()}
+		if isDir {
+			s.Text += string(os.PathSeparator)
+		}
+		if c.Describe != nil {
+			s.Description = c.Describe(f)
+		}
+		suggests = append(suggests, s)
+	}
+	suggests = prompt.FilterHasPrefix(suggests, base, c.IgnoreCase)
+	if c.Tokenizer != nil {
+		// The whole token is replaced, keep the typed directory.
+		prefix := path[:strings.LastIndexByte(path, os.PathSeparator)+1]
+		for i := range suggests {
+			suggests[i].Display = suggests[i].Text
+			suggests[i].Text = prefix + suggests[i].Text
+		}
+	}
+	return suggests
+}
+
+// readDir returns the content of the directory from the cache if the
+// directory is not modified after it was cached.
+func (c *FilePathCompleter) readDir(dir string) ([]os.FileInfo, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := c.fileListCache[dir]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.files, nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	c.fileListCache[dir] = fileList{modTime: info.ModTime(), files: files}
+	return files, nil
+}
+
+// hasExtension returns true if the file has one of the extensions.
+func (c *FilePathCompleter) hasExtension(name string) bool {
+	if len(c.Extensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(name)
+	for _, e := range c.Extensions {
+		if ext == e || (c.IgnoreCase && strings.EqualFold(ext, e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirectory returns true if the file in the directory is a directory or
+// a symbolic link to a directory.
+func isDirectory(dir string, fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return fi.IsDir()
+	}
+	target, err := os.Stat(filepath.Join(dir, fi.Name()))
+	return err == nil && target.IsDir()
+}
+
+// FileSize returns the size of the file in a human-readable form like
+// "12K", it is empty for directories.
+func FileSize(fi os.FileInfo) string {
+	if fi.IsDir() {
+		return ""
+	}
+	size := float64(fi.Size())
+	for _, unit := range []string{"B", "K", "M", "G", "T"} {
+		if size < 1024 || unit == "T" {
+			if unit == "B" || size >= 10 {
+				return fmt.Sprintf("%.0f%s", size, unit)
+			}
+			return fmt.Sprintf("%.1f%s", size, unit)
+		}
+		size /= 1024
+	}
+	return ""
+}
+
+// FileType returns the type of the file: "directory", "symlink", "pipe",
+// "socket", "device", "executable" or "file".
+func FileType(fi os.FileInfo) string {
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode&0111 != 0:
+		return "executable"
 	}
-	c.fileListCache[dir] = suggests
-	return prompt.FilterHasPrefix(suggests, base, c.IgnoreCase)
+	return "file"
 }
@@ -0,0 +1,100 @@
+package completer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	prompt "github.com/tarantool/go-prompt"
+)
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "go-prompt-file")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "my dir"), 0755))
+	for _, name := range []string{".hidden", "main.go", "README.md", "my dir/file.go"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("data"), 0644))
+	}
+	return dir + string(os.PathSeparator)
+}
+
+func TestFilePathCompleter(t *testing.T) {
+	dir := newTestDir(t)
+	c := FilePathCompleter{}
+
+	actual := c.Complete(newTestDocument(dir))
+	assert.Equal(t, []string{".hidden", "README.md", "main.go", "my dir/"}, suggestTexts(actual))
+
+	c.HideDotFiles = true
+	actual = c.Complete(newTestDocument(dir))
+	assert.Equal(t, []string{"README.md", "main.go", "my dir/"}, suggestTexts(actual))
+	actual = c.Complete(newTestDocument(dir + "."))
+	assert.Equal(t, []string{".hidden"}, suggestTexts(actual))
+
+	c.Extensions = []string{".GO"}
+	c.IgnoreCase = true
+	actual = c.Complete(newTestDocument(dir))
+	assert.Equal(t, []string{"main.go", "my dir/"}, suggestTexts(actual))
+}
+
+func TestFilePathCompleterCache(t *testing.T) {
+	dir := newTestDir(t)
+	c := FilePathCompleter{}
+
+	actual := c.Complete(newTestDocument(dir + "n"))
+	assert.Empty(t, actual)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new.go"), nil, 0644))
+	// The modification time may be too coarse to change.
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(dir, later, later))
+	actual = c.Complete(newTestDocument(dir + "n"))
+	assert.Equal(t, []string{"new.go"}, suggestTexts(actual))
+}
+
+func TestFilePathCompleterTokenizer(t *testing.T) {
+	dir := newTestDir(t)
+	c := FilePathCompleter{Tokenizer: prompt.ShellTokenizer{}, Describe: FileType}
+
+	actual := c.Complete(newTestDocument(`ls "` + dir + "my d"))
+	require.Len(t, actual, 1)
+	assert.Equal(t, dir+"my dir/", actual[0].Text)
+	assert.Equal(t, "my dir/", actual[0].Display)
+	assert.Equal(t, "directory", actual[0].Description)
+
+	actual = c.Complete(newTestDocument(`ls ` + dir + `my\ dir/`))
+	require.Len(t, actual, 1)
+	assert.Equal(t, dir+"my dir/file.go", actual[0].Text)
+	assert.Equal(t, "file", actual[0].Description)
+}
+
+func TestFileSize(t *testing.T) {
+	dir := newTestDir(t)
+	scenarioTable := []struct {
+		size     int
+		expected string
+	}{
+		{size: 0, expected: "0B"},
+		{size: 1023, expected: "1023B"},
+		{size: 1536, expected: "1.5K"},
+		{size: 20 << 20, expected: "20M"},
+	}
+
+	for _, s := range scenarioTable {
+		path := filepath.Join(dir, "size")
+		require.NoError(t, ioutil.WriteFile(path, make([]byte, s.size), 0644))
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, s.expected, FileSize(fi))
+	}
+
+	fi, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "", FileSize(fi))
+}
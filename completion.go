@@ -1,7 +1,10 @@
 package prompt
 
 import (
+	"context"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	runewidth "github.com/mattn/go-runewidth"
 	"github.com/tarantool/go-prompt/internal/debug"
@@ -21,10 +24,97 @@ var (
 	completionMargin = leftMargin + rightMargin
 )
 
+// CompletionLayout is the layout of the completion menu.
+type CompletionLayout int
+
+const (
+	// CompletionLayoutList shows the suggestions with their descriptions
+	// in a vertical list.
+	CompletionLayoutList CompletionLayout = iota
+	// CompletionLayoutGrid shows the suggestions in a grid filling
+	// the terminal width. The list is used instead if any suggestion
+	// has a description or a group.
+	CompletionLayoutGrid
+)
+
+// CompletionPlacement is the placement of the completion menu relative to
+// the input.
+type CompletionPlacement int
+
+const (
+	// CompletionPlacementBelow places the menu below the input scrolling
+	// the terminal if it is needed.
+	CompletionPlacementBelow CompletionPlacement = iota
+	// CompletionPlacementAbove places the menu above the input, if there
+	// are free rows.
+	CompletionPlacementAbove
+	// CompletionPlacementAuto places the menu above the input, if it does
+	// not fit below and there are more rows above.
+	CompletionPlacementAuto
+)
+
+// CompletionTrigger defines when the completer is called and the completion
+// menu is shown. Tab always shows the menu.
+type CompletionTrigger int
+
+const (
+	// CompletionTriggerAlways shows the suggestions on every input update.
+	CompletionTriggerAlways CompletionTrigger = iota
+	// CompletionTriggerTab shows the suggestions only on Tab.
+	CompletionTriggerTab
+	// CompletionTriggerAuto shows the suggestions when the word before
+	// the cursor is long enough (see OptionCompletionMinLength) or it
+	// contains or follows a trigger character (see
+	// OptionCompletionTriggerCharacters).
+	CompletionTriggerAuto
+)
+
 // Suggest is printed when completing.
 type Suggest struct {
 	Text        string
 	Description string
+	// Group is the name of the section in the completion menu. The suggestions
+	// are shown grouped under the section headers in the order of the first
+	// appearance of their groups, the suggestions without a group go first.
+	Group string
+	// Display is shown in the completion menu instead of Text, if it is set.
+	Display string
+	// Insert is inserted instead of Text, if it is set.
+	Insert string
+	// Replace is the range of the document text replaced by the suggestion.
+	// If it is nil, the word before the cursor is replaced.
+	Replace *SuggestRange
+	// CursorOffset moves the cursor from the end of the inserted text,
+	// a negative offset moves it backward.
+	CursorOffset int
+	// Payload is an arbitrary user data.
+	Payload interface{}
+	// Documentation is a long multi-line text shown in the panel next to
+	// the completion menu, when the suggestion is selected.
+	Documentation string
+}
+
+// SuggestRange is a range of runes [Start, End) in the document text.
+// It must contain the cursor position.
+type SuggestRange struct {
+	Start int
+	End   int
+}
+
+// label returns the text to show in the completion menu.
+func (s Suggest) label() string {
+	if s.Display != "" {
+		return s.Display
+	}
+	return s.Text
+}
+
+// insertText returns the text to insert on the acceptance.
+func (s Suggest) insertText() string {
+	if s.Insert != "" {
+		return s.Insert
+	}
+	return s.Text
 }
 
 // CompletionManager manages which suggestion is now selected.
@@ -37,6 +127,86 @@ type CompletionManager struct {
 	verticalScroll int
 	wordSeparator  string
 	showAtStart    bool
+
+	// tokenizer finds the word before the cursor instead of wordSeparator
+	// if it is not nil.
+	tokenizer Tokenizer
+
+	// matches contains positions of the matched runes in the suggestion
+	// texts to highlight, nil if they are not highlighted.
+	matches [][]int
+
+	// asyncCompleter is called in the background instead of completer,
+	// if it is set.
+	asyncCompleter AsyncCompleter
+	// debounce is the delay before the asyncCompleter call.
+	debounce time.Duration
+	// loadingIndicator is shown instead of the suggestions while
+	// the asyncCompleter is running, empty if it is not shown.
+	loadingIndicator string
+	// loading is true if the result of the last request is not received yet.
+	loading bool
+	// request is the number of the last asyncCompleter request.
+	request uint64
+	// requestDoc is the document of the last asyncCompleter request.
+	requestDoc *Document
+	// cancel cancels the context of the last asyncCompleter request.
+	cancel context.CancelFunc
+	// results receives the suggestions of the asyncCompleter requests.
+	results chan asyncResult
+
+	// layout is the layout of the completion menu.
+	layout CompletionLayout
+	// layoutFunc chooses the layout for the suggestions instead of layout,
+	// if it is set.
+	layoutFunc func(Document, []Suggest) CompletionLayout
+	// grid is true if the suggestions are shown in the grid. Then
+	// verticalScroll is the number of the first visible row.
+	grid bool
+	// width is the terminal width to lay out the grid.
+	width int
+	// highlightMatches is true if the runes of the suggestions fuzzy matched
+	// by the word before the cursor are highlighted.
+	highlightMatches bool
+	// documentationFunc returns the documentation of the selected suggestion
+	// without Documentation, nil if it is not used.
+	documentationFunc func(Suggest) string
+	// doc is the documentation of the suggestion at docIndex,
+	// docIndex is -1 if it is not fetched.
+	doc      string
+	docIndex int
+	// docScroll is the first visible line of the documentation.
+	docScroll int
+	// trigger defines when the suggestions are shown.
+	trigger CompletionTrigger
+	// minLength is the minimal length of the word before the cursor to show
+	// the suggestions automatically, 0 if the length does not matter.
+	minLength int
+	// triggerCharacters are the characters showing the suggestions
+	// automatically.
+	triggerCharacters string
+	// triggered is true if the suggestions are requested by Trigger for
+	// the word started after triggerPrefix.
+	triggered     bool
+	triggerPrefix string
+	// height is the number of the visible rows of the menu adapted to
+	// the terminal by the renderer, 0 if max is used.
+	height int
+	// input is the document of the last update.
+	input Document
+	// closed is true if the menu is closed by Cancel. It is reopened when
+	// the document changes or a suggestion is selected.
+	closed bool
+	// headers are the indexes of the suggestions starting the groups
+	// with headers. If it is not empty, verticalScroll is the number of
+	// the first visible row including the headers.
+	headers []int
+}
+
+// asyncResult contains the suggestions of the asyncCompleter request.
+type asyncResult struct {
+	request  uint64
+	suggests []Suggest
 }
 
 // GetSelectedSuggestion returns the selected item.
@@ -56,24 +226,218 @@ func (c *CompletionManager) GetSuggestions() []Suggest {
 	return c.tmp
 }
 
-// Reset to select nothing.
+// Reset to select nothing and to hide the suggestions shown by Trigger.
 func (c *CompletionManager) Reset() {
 	c.selected = -1
 	c.verticalScroll = 0
+	c.triggered = false
+	c.triggerPrefix = ""
 	c.Update(*NewDocument())
 }
 
-// Update to update the suggestions.
+// Update to update the suggestions. If the AsyncCompleter is set, the update
+// is started in the background and the suggestions are set later.
 func (c *CompletionManager) Update(in Document) {
-	c.tmp = c.completer(in)
+	if c.closed && (in.Text != c.input.Text || in.cursorPosition != c.input.cursorPosition) {
+		c.closed = false
+	}
+	c.input = in
+	if c.closed {
+		// The suggestions of the document are kept while the menu is closed.
+		return
+	}
+	if !c.isTriggered(in) {
+		// The completer is not called while the menu is hidden.
+		c.cancelAsync()
+		c.requestDoc = nil
+		c.setSuggestions(in, nil)
+		return
+	}
+	if c.asyncCompleter != nil {
+		c.updateAsync(in)
+		return
+	}
+	c.setSuggestions(in, c.completer(in))
+}
+
+// Trigger shows the suggestions for the document regardless of the trigger
+// policy. They are shown until the word before the cursor is left.
+func (c *CompletionManager) Trigger(in Document) {
+	c.triggered = true
+	c.triggerPrefix = c.wordPrefix(in)
+	c.closed = false
+	c.Update(in)
+}
+
+// isTriggered returns true if the suggestions are shown for the document.
+func (c *CompletionManager) isTriggered(in Document) bool {
+	if c.triggered && c.wordPrefix(in) != c.triggerPrefix {
+		c.triggered = false
+	}
+	if c.triggered {
+		return true
+	}
+	switch c.trigger {
+	case CompletionTriggerAlways:
+		return true
+	case CompletionTriggerAuto:
+		word, _ := c.word(in)
+		if c.minLength > 0 && utf8.RuneCountInString(word) >= c.minLength {
+			return true
+		}
+		if c.triggerCharacters == "" {
+			return false
+		}
+		last, _ := utf8.DecodeLastRuneInString(c.wordPrefix(in))
+		return strings.ContainsAny(word, c.triggerCharacters) ||
+			strings.ContainsRune(c.triggerCharacters, last)
+	}
+	return false
+}
+
+// wordPrefix returns the text before the word before the cursor.
+func (c *CompletionManager) wordPrefix(in Document) string {
+	_, start := c.word(in)
+	return string([]rune(in.TextBeforeCursor())[:start])
+}
+
+// word returns the word before the cursor without the quotes and the
+// position of its start.
+func (c *CompletionManager) word(in Document) (word string, start int) {
+	if c.tokenizer != nil {
+		token := in.GetTokenBeforeCursor(c.tokenizer)
+		return token.Value, token.Start
+	}
+	word = in.GetWordBeforeCursorUntilSeparator(c.wordSeparator)
+	return word, len([]rune(in.TextBeforeCursor())) - len([]rune(word))
+}
+
+// quote returns the text to insert instead of the word before the cursor
+// quoted by the tokenizer like the word. The quote is not closed if the text
+// is not complete.
+func (c *CompletionManager) quote(text string, d *Document, complete bool) string {
+	if c.tokenizer == nil {
+		return text
+	}
+	return c.tokenizer.Quote(text, d.GetTokenBeforeCursor(c.tokenizer).Quote, complete)
+}
+
+// setSuggestions sets the suggestions for the document keeping the selection
+// if it is possible.
+func (c *CompletionManager) setSuggestions(in Document, suggests []Suggest) {
+	c.tmp, c.headers = groupSuggestions(suggests)
+	c.matches = nil
+	c.docIndex = -1
+	if c.highlightMatches {
+		word, _ := c.word(in)
+		c.matches = fuzzyHighlights(c.tmp, word)
+	}
 	if c.selected >= len(c.tmp) {
 		c.selected = -1
 		c.verticalScroll = 0
 	}
+
+	layout := c.layout
+	if c.layoutFunc != nil {
+		layout = c.layoutFunc(in, suggests)
+	}
+	grid := layout == CompletionLayoutGrid && !hasDescriptions(suggests) &&
+		len(c.headers) == 0
+	if grid != c.grid {
+		// The scroll position is not compatible between the layouts.
+		c.grid = grid
+		c.selected = -1
+		c.verticalScroll = 0
+	}
+	if c.grid {
+		c.scrollGrid()
+	} else if len(c.headers) > 0 {
+		c.scrollGroups()
+	}
+}
+
+// updateAsync cancels the previous asyncCompleter request and starts a new one
+// for the document. Nothing is done if the text and the cursor position are
+// the same as in the last request.
+func (c *CompletionManager) updateAsync(in Document) {
+	if c.requestDoc != nil && c.requestDoc.Text == in.Text &&
+		c.requestDoc.cursorPosition == in.cursorPosition {
+		return
+	}
+	c.cancelAsync()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.request++
+	c.requestDoc = &in
+	c.loading = true
+	go runAsyncCompleter(ctx, c.asyncCompleter, in, c.debounce,
+		c.request, c.results)
+}
+
+// applyAsyncResult sets the suggestions of the asyncCompleter request.
+// It returns false if the result is outdated and ignored.
+func (c *CompletionManager) applyAsyncResult(r asyncResult) bool {
+	if r.request != c.request || !c.loading {
+		return false
+	}
+	c.cancelAsync()
+	c.setSuggestions(*c.requestDoc, r.suggests)
+	return true
+}
+
+// cancelAsync cancels the running asyncCompleter request.
+func (c *CompletionManager) cancelAsync() {
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	c.loading = false
+}
+
+// runAsyncCompleter calls the completer after the debounce delay and sends
+// the suggestions to results. Nothing is sent if the context is cancelled.
+func runAsyncCompleter(ctx context.Context, completer AsyncCompleter, in Document,
+	debounce time.Duration, request uint64, results chan<- asyncResult) {
+	if debounce > 0 {
+		timer := time.NewTimer(debounce)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	suggests := completer(ctx, in)
+	select {
+	case results <- asyncResult{request: request, suggests: suggests}:
+	case <-ctx.Done():
+	}
 }
 
 // Previous to select the previous suggestion item.
 func (c *CompletionManager) Previous() {
+	if len(c.tmp) == 0 {
+		return
+	}
+	c.closed = false
+	if c.grid {
+		c.selected--
+		if c.selected < -1 {
+			c.selected = len(c.tmp) - 1
+		}
+		c.scrollGrid()
+		return
+	}
+	if len(c.headers) > 0 {
+		c.selected--
+		if c.selected < -1 {
+			c.selected = len(c.tmp) - 1
+		}
+		c.scrollGroups()
+		return
+	}
 	if c.verticalScroll == c.selected && c.selected > 0 {
 		c.verticalScroll--
 	}
@@ -83,20 +447,333 @@ func (c *CompletionManager) Previous() {
 
 // Next to select the next suggestion item.
 func (c *CompletionManager) Next() {
-	if c.verticalScroll+int(c.max)-1 == c.selected {
+	if len(c.tmp) == 0 {
+		return
+	}
+	c.closed = false
+	if c.grid {
+		c.selected++
+		if c.selected >= len(c.tmp) {
+			c.selected = -1
+		}
+		c.scrollGrid()
+		return
+	}
+	if len(c.headers) > 0 {
+		c.selected++
+		if c.selected >= len(c.tmp) {
+			c.selected = -1
+		}
+		c.scrollGroups()
+		return
+	}
+	if c.verticalScroll+c.visibleRows()-1 == c.selected {
 		c.verticalScroll++
 	}
 	c.selected++
 	c.update()
 }
 
+// PageUp selects the suggestion a page above the selected one or the first one.
+func (c *CompletionManager) PageUp() {
+	c.selectIndex(c.selected - c.pageSize())
+}
+
+// PageDown selects the suggestion a page below the selected one or the last one.
+func (c *CompletionManager) PageDown() {
+	c.selectIndex(c.selected + c.pageSize())
+}
+
+// First selects the first suggestion.
+func (c *CompletionManager) First() {
+	c.selectIndex(0)
+}
+
+// Last selects the last suggestion.
+func (c *CompletionManager) Last() {
+	c.selectIndex(len(c.tmp) - 1)
+}
+
+// Cancel closes the menu without the selected suggestion, so the text typed
+// before the selection is kept. The menu is reopened when the document
+// changes or a suggestion is selected.
+func (c *CompletionManager) Cancel() {
+	c.selected = -1
+	c.verticalScroll = 0
+	c.closed = true
+	c.triggered = false
+}
+
+// Position returns the number of the selected suggestion starting from 1,
+// 0 if nothing is selected, and the number of the suggestions.
+func (c *CompletionManager) Position() (selected, total int) {
+	return c.selected + 1, len(c.tmp)
+}
+
+// visibleRows returns the max number of the visible rows of the menu.
+func (c *CompletionManager) visibleRows() int {
+	if c.height > 0 {
+		return c.height
+	}
+	return int(c.max)
+}
+
+// setHeight sets the number of the visible rows of the menu, 0 to use max.
+// The scroll is fixed to keep the selected suggestion visible.
+func (c *CompletionManager) setHeight(height int) {
+	if height == c.height {
+		return
+	}
+	c.height = height
+	rows := len(c.tmp) + len(c.headers)
+	if c.grid {
+		rows = (len(c.tmp) + c.gridColumns() - 1) / c.gridColumns()
+	}
+	if maxScroll := rows - c.visibleRows(); c.verticalScroll > maxScroll {
+		c.verticalScroll = maxScroll
+	}
+	if c.verticalScroll < 0 {
+		c.verticalScroll = 0
+	}
+	if c.selected != -1 {
+		c.selectIndex(c.selected)
+	}
+}
+
+// shown returns true if there are suggestions and the menu is not closed.
+func (c *CompletionManager) shown() bool {
+	return len(c.tmp) > 0 && !c.closed
+}
+
+// pageSize returns the number of the suggestions on a page of the menu.
+func (c *CompletionManager) pageSize() int {
+	if c.grid {
+		return c.visibleRows() * c.gridColumns()
+	}
+	return c.visibleRows()
+}
+
+// selectIndex selects the suggestion at the index clamped to the suggestions
+// and scrolls the menu to make it visible.
+func (c *CompletionManager) selectIndex(index int) {
+	if len(c.tmp) == 0 {
+		return
+	}
+	c.closed = false
+	if index < 0 {
+		index = 0
+	} else if index >= len(c.tmp) {
+		index = len(c.tmp) - 1
+	}
+	c.selected = index
+	switch {
+	case c.grid:
+		c.scrollGrid()
+	case len(c.headers) > 0:
+		c.scrollGroups()
+	case c.selected < c.verticalScroll:
+		c.verticalScroll = c.selected
+	case c.selected >= c.verticalScroll+c.visibleRows():
+		c.verticalScroll = c.selected - c.visibleRows() + 1
+	}
+}
+
+// replaceRange returns the numbers of runes before and after the cursor,
+// which are replaced by the suggestion in the document.
+func (c *CompletionManager) replaceRange(s Suggest, d *Document) (before, after int) {
+	cursor := len([]rune(d.TextBeforeCursor()))
+	if s.Replace == nil && c.tokenizer != nil {
+		token := d.GetTokenAtCursor(c.tokenizer)
+		return cursor - token.Start, token.End - cursor
+	}
+	if s.Replace == nil {
+		return len([]rune(d.GetWordBeforeCursorUntilSeparator(c.wordSeparator))), 0
+	}
+	end := cursor + len([]rune(d.TextAfterCursor()))
+	if s.Replace.Start >= 0 && s.Replace.Start <= cursor {
+		before = cursor - s.Replace.Start
+	}
+	if s.Replace.End >= cursor && s.Replace.End <= end {
+		after = s.Replace.End - cursor
+	}
+	return before, after
+}
+
+// PreviousRow selects the suggestion above the selected one in the grid
+// layout. In the list layout it is the same as Previous.
+func (c *CompletionManager) PreviousRow() {
+	c.closed = false
+	if !c.grid {
+		c.Previous()
+		return
+	}
+	columns := c.gridColumns()
+	switch {
+	case c.selected == -1:
+		c.selected = len(c.tmp) - 1
+	case c.selected >= columns:
+		c.selected -= columns
+	default:
+		c.selected = -1
+	}
+	c.scrollGrid()
+}
+
+// NextRow selects the suggestion below the selected one in the grid
+// layout. In the list layout it is the same as Next.
+func (c *CompletionManager) NextRow() {
+	c.closed = false
+	if !c.grid {
+		c.Next()
+		return
+	}
+	if len(c.tmp) == 0 {
+		return
+	}
+	columns := c.gridColumns()
+	lastRow := (len(c.tmp) - 1) / columns
+	switch {
+	case c.selected == -1:
+		c.selected = 0
+	case c.selected+columns < len(c.tmp):
+		c.selected += columns
+	case c.selected/columns < lastRow:
+		// The last row is shorter, select its last suggestion.
+		c.selected = len(c.tmp) - 1
+	default:
+		c.selected = -1
+	}
+	c.scrollGrid()
+}
+
+// Layout returns the layout of the shown suggestions.
+func (c *CompletionManager) Layout() CompletionLayout {
+	if c.grid {
+		return CompletionLayoutGrid
+	}
+	return CompletionLayoutList
+}
+
+// gridColumns returns the number of the grid columns.
+func (c *CompletionManager) gridColumns() int {
+	if _, columns := gridLayout(c.tmp, c.width); columns > 0 {
+		return columns
+	}
+	return 1
+}
+
+// scrollGrid scrolls the grid to make the row of the selected suggestion visible.
+func (c *CompletionManager) scrollGrid() {
+	if c.selected == -1 {
+		c.verticalScroll = 0
+		return
+	}
+	row := c.selected / c.gridColumns()
+	if row < c.verticalScroll {
+		c.verticalScroll = row
+	} else if row >= c.verticalScroll+c.visibleRows() {
+		c.verticalScroll = row - c.visibleRows() + 1
+	}
+}
+
+// scrollGroups scrolls the grouped list to make the row of the selected
+// suggestion visible with the header of its group, if it is the first one.
+func (c *CompletionManager) scrollGroups() {
+	if c.selected == -1 {
+		c.verticalScroll = 0
+		return
+	}
+	row := c.rowOf(c.selected)
+	top := row
+	if c.visibleRows() > 1 && c.isGroupStart(c.selected) {
+		top--
+	}
+	if top < c.verticalScroll {
+		c.verticalScroll = top
+	} else if row >= c.verticalScroll+c.visibleRows() {
+		c.verticalScroll = row - c.visibleRows() + 1
+	}
+}
+
+// isGroupStart returns true if the suggestion is the first one under a header.
+func (c *CompletionManager) isGroupStart(index int) bool {
+	for _, h := range c.headers {
+		if h == index {
+			return true
+		}
+	}
+	return false
+}
+
+// rowOf returns the row of the suggestion in the list including the headers,
+// -1 for -1.
+func (c *CompletionManager) rowOf(index int) int {
+	if index < 0 {
+		return index
+	}
+	row := index
+	for _, h := range c.headers {
+		if h <= index {
+			row++
+		}
+	}
+	return row
+}
+
+// menuRows returns the rows of the list: the suggestions with the group
+// headers. items are the indexes of the suggestions in the rows, -1 for
+// the headers.
+func (c *CompletionManager) menuRows() (rows []Suggest, items []int) {
+	rows = make([]Suggest, 0, len(c.tmp)+len(c.headers))
+	items = make([]int, 0, len(c.tmp)+len(c.headers))
+	h := 0
+	for i, s := range c.tmp {
+		if h < len(c.headers) && c.headers[h] == i {
+			rows = append(rows, Suggest{Text: s.Group})
+			items = append(items, -1)
+			h++
+		}
+		rows = append(rows, s)
+		items = append(items, i)
+	}
+	return rows, items
+}
+
+// ScrollDocumentation scrolls the documentation of the selected suggestion
+// by n lines, a negative n scrolls it up.
+func (c *CompletionManager) ScrollDocumentation(n int) {
+	c.docScroll += n
+	if c.docScroll < 0 {
+		c.docScroll = 0
+	}
+}
+
+// documentation returns the documentation of the selected suggestion, empty
+// if there is nothing to show. If the suggestion has no Documentation, it is
+// fetched by documentationFunc once for the selection.
+func (c *CompletionManager) documentation() string {
+	s, ok := c.GetSelectedSuggestion()
+	if !ok {
+		return ""
+	}
+	if c.docIndex != c.selected {
+		c.docIndex = c.selected
+		c.docScroll = 0
+		c.doc = s.Documentation
+		if c.doc == "" && c.documentationFunc != nil {
+			c.doc = c.documentationFunc(s)
+		}
+	}
+	return c.doc
+}
+
 // Completing returns whether the CompletionManager selects something one.
 func (c *CompletionManager) Completing() bool {
 	return c.selected != -1
 }
 
 func (c *CompletionManager) update() {
-	max := int(c.max)
+	max := c.visibleRows()
 	if len(c.tmp) < max {
 		max = len(c.tmp)
 	}
@@ -149,8 +826,9 @@ func formatTexts(o []string, max int, prefix, suffix string) (new []string, widt
 			n[i] = prefix + o[i] + spaces + suffix
 		} else if x > width {
 			x := runewidth.Truncate(o[i], width, shortenSuffix)
-			// When calling runewidth.Truncate("您好xxx您好xxx", 11, "...") returns "您好xxx..."
-			// But the length of this result is 10. So we need fill right using runewidth.FillRight.
+			// When calling runewidth.Truncate("您好xxx您好xxx", 11, "...")
+			// returns "您好xxx..." But the length of this result is 10.
+			// So we need fill right using runewidth.FillRight.
 			n[i] = prefix + runewidth.FillRight(x, width) + suffix
 		}
 	}
@@ -163,7 +841,7 @@ func formatSuggestions(suggests []Suggest, max int) (new []Suggest, width int) {
 
 	left := make([]string, num)
 	for i := 0; i < num; i++ {
-		left[i] = suggests[i].Text
+		left[i] = suggests[i].label()
 	}
 	right := make([]string, num)
 	for i := 0; i < num; i++ {
@@ -182,10 +860,101 @@ func formatSuggestions(suggests []Suggest, max int) (new []Suggest, width int) {
 	return new, leftWidth + rightWidth
 }
 
+// groupSuggestions orders the suggestions by their groups keeping the order
+// inside the groups. The suggestions without a group go first, other groups
+// go in the order of their first appearance. It returns the indexes of
+// the suggestions starting the groups with headers.
+func groupSuggestions(suggests []Suggest) (grouped []Suggest, headers []int) {
+	var order []string
+	byGroup := make(map[string][]Suggest)
+	for _, s := range suggests {
+		if _, ok := byGroup[s.Group]; !ok && s.Group != "" {
+			order = append(order, s.Group)
+		}
+		byGroup[s.Group] = append(byGroup[s.Group], s)
+	}
+	if len(order) == 0 {
+		return suggests, nil
+	}
+
+	grouped = make([]Suggest, 0, len(suggests))
+	grouped = append(grouped, byGroup[""]...)
+	headers = make([]int, 0, len(order))
+	for _, group := range order {
+		headers = append(headers, len(grouped))
+		grouped = append(grouped, byGroup[group]...)
+	}
+	return grouped, headers
+}
+
+// commonPrefix returns the longest common prefix of the texts to insert.
+func commonPrefix(suggests []Suggest) string {
+	if len(suggests) == 0 {
+		return ""
+	}
+	prefix := []rune(suggests[0].insertText())
+	for _, s := range suggests[1:] {
+		i := 0
+		for _, r := range s.insertText() {
+			if i >= len(prefix) || prefix[i] != r {
+				break
+			}
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return string(prefix)
+}
+
+// fuzzyHighlights returns the positions of the runes of the suggestion labels
+// fuzzy matched by the word, nil if there is nothing to highlight. The word is
+// matched case-insensitively if it has no upper case letters.
+func fuzzyHighlights(suggests []Suggest, word string) [][]int {
+	if word == "" {
+		return nil
+	}
+	ignoreCase := word == strings.ToLower(word)
+	matches := make([][]int, len(suggests))
+	for i, s := range suggests {
+		if _, positions, ok := FuzzyScore(s.label(), word, ignoreCase); ok {
+			matches[i] = positions
+		}
+	}
+	return matches
+}
+
+// hasDescriptions returns true if any suggestion has a description.
+func hasDescriptions(suggests []Suggest) bool {
+	for _, s := range suggests {
+		if s.Description != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// gridLayout formats the suggestion texts to the cells of the same width
+// and returns them with the number of the grid columns fitting into
+// the terminal width, zero if the grid does not fit.
+func gridLayout(suggests []Suggest, width int) (cells []string, columns int) {
+	texts := make([]string, len(suggests))
+	for i, s := range suggests {
+		texts[i] = s.label()
+	}
+	// -1 means a width of scrollbar, another -1 prevents a line wrap.
+	available := width - 2
+	cells, cellWidth := formatTexts(texts, available, leftPrefix, leftSuffix)
+	if cellWidth == 0 {
+		return cells, 0
+	}
+	return cells, available / cellWidth
+}
+
 // NewCompletionManager returns initialized CompletionManager object.
 func NewCompletionManager(completer Completer, max uint16) *CompletionManager {
 	return &CompletionManager{
 		selected:  -1,
+		docIndex:  -1,
 		max:       max,
 		completer: completer,
 
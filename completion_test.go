@@ -1,8 +1,13 @@
 package prompt
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFormatShortSuggestion(t *testing.T) {
@@ -262,3 +267,496 @@ func TestFormatText(t *testing.T) {
 		}
 	}
 }
+
+func newAsyncCompletionManager(completer AsyncCompleter) *CompletionManager {
+	c := NewCompletionManager(nil, 6)
+	c.asyncCompleter = completer
+	c.results = make(chan asyncResult)
+	return c
+}
+
+func receiveAsyncResult(t *testing.T, c *CompletionManager) asyncResult {
+	t.Helper()
+	select {
+	case r := <-c.results:
+		return r
+	case <-time.After(time.Second):
+		require.Fail(t, "no async completion result")
+	}
+	return asyncResult{}
+}
+
+func TestAsyncCompletion(t *testing.T) {
+	c := newAsyncCompletionManager(func(ctx context.Context, d Document) []Suggest {
+		return []Suggest{{Text: d.Text + "1"}, {Text: d.Text + "2"}}
+	})
+
+	c.Update(Document{Text: "a", cursorPosition: 1})
+	assert.True(t, c.loading)
+	assert.Empty(t, c.GetSuggestions())
+	assert.True(t, c.applyAsyncResult(receiveAsyncResult(t, c)))
+	assert.False(t, c.loading)
+	assert.Equal(t, []Suggest{{Text: "a1"}, {Text: "a2"}}, c.GetSuggestions())
+
+	// The same input is not requested again.
+	c.Next()
+	c.Update(Document{Text: "a", cursorPosition: 1})
+	assert.False(t, c.loading)
+	assert.Equal(t, uint64(1), c.request)
+	assert.Equal(t, 0, c.selected)
+
+	// The selection is kept with the new suggestions.
+	c.Update(Document{Text: "b", cursorPosition: 1})
+	assert.Equal(t, []Suggest{{Text: "a1"}, {Text: "a2"}}, c.GetSuggestions())
+	assert.True(t, c.applyAsyncResult(receiveAsyncResult(t, c)))
+	assert.Equal(t, []Suggest{{Text: "b1"}, {Text: "b2"}}, c.GetSuggestions())
+	assert.Equal(t, 0, c.selected)
+}
+
+func TestAsyncCompletionCancel(t *testing.T) {
+	cancelled := make(chan string, 1)
+	c := newAsyncCompletionManager(func(ctx context.Context, d Document) []Suggest {
+		if d.Text == "slow" {
+			<-ctx.Done()
+			cancelled <- d.Text
+			return []Suggest{{Text: "outdated"}}
+		}
+		return []Suggest{{Text: d.Text}}
+	})
+
+	c.Update(Document{Text: "slow"})
+	c.Update(Document{Text: "fast"})
+	select {
+	case text := <-cancelled:
+		assert.Equal(t, "slow", text)
+	case <-time.After(time.Second):
+		require.Fail(t, "the request is not cancelled")
+	}
+	assert.True(t, c.applyAsyncResult(receiveAsyncResult(t, c)))
+	assert.Equal(t, []Suggest{{Text: "fast"}}, c.GetSuggestions())
+
+	// An outdated result is ignored.
+	assert.False(t, c.applyAsyncResult(asyncResult{request: 1, suggests: []Suggest{{Text: "x"}}}))
+	assert.Equal(t, []Suggest{{Text: "fast"}}, c.GetSuggestions())
+}
+
+func TestAsyncCompletionDebounce(t *testing.T) {
+	requested := make(chan string, 3)
+	c := newAsyncCompletionManager(func(ctx context.Context, d Document) []Suggest {
+		requested <- d.Text
+		return []Suggest{{Text: d.Text}}
+	})
+	c.debounce = 50 * time.Millisecond
+
+	c.Update(Document{Text: "x"})
+	c.Update(Document{Text: "xy"})
+	c.Update(Document{Text: "xyz"})
+	assert.True(t, c.applyAsyncResult(receiveAsyncResult(t, c)))
+	assert.Equal(t, []Suggest{{Text: "xyz"}}, c.GetSuggestions())
+	require.Len(t, requested, 1)
+	assert.Equal(t, "xyz", <-requested)
+}
+
+func TestCompletionGridNavigation(t *testing.T) {
+	suggests := []Suggest{
+		{Text: "a"}, {Text: "b"}, {Text: "c"}, {Text: "d"},
+		{Text: "e"}, {Text: "f"}, {Text: "g"},
+	}
+	c := NewCompletionManager(func(Document) []Suggest { return suggests }, 6)
+	c.layout = CompletionLayoutGrid
+	// 4 columns of 3 runes with the scrollbar.
+	c.width = 14
+	c.Update(Document{})
+	require.Equal(t, CompletionLayoutGrid, c.Layout())
+	assert.Equal(t, 4, c.gridColumns())
+
+	c.NextRow()
+	assert.Equal(t, 0, c.selected)
+	c.NextRow()
+	assert.Equal(t, 4, c.selected)
+	c.NextRow()
+	assert.Equal(t, -1, c.selected)
+
+	c.selected = 3
+	c.NextRow()
+	assert.Equal(t, 6, c.selected, "the last suggestion of the shorter row")
+	c.PreviousRow()
+	assert.Equal(t, 2, c.selected)
+	c.PreviousRow()
+	assert.Equal(t, -1, c.selected)
+	c.PreviousRow()
+	assert.Equal(t, 6, c.selected)
+
+	c.Next()
+	assert.Equal(t, -1, c.selected)
+	c.Previous()
+	assert.Equal(t, 6, c.selected)
+	c.Previous()
+	assert.Equal(t, 5, c.selected)
+
+	// The selection is kept after the update.
+	c.Update(Document{})
+	assert.Equal(t, 5, c.selected)
+
+	// Only the rows are scrolled.
+	c.max = 1
+	c.selected = -1
+	c.NextRow()
+	assert.Equal(t, 0, c.verticalScroll)
+	c.NextRow()
+	assert.Equal(t, 1, c.verticalScroll)
+	c.PreviousRow()
+	assert.Equal(t, 0, c.verticalScroll)
+}
+
+func TestCompletionLayout(t *testing.T) {
+	suggests := []Suggest{{Text: "a"}, {Text: "b"}}
+	c := NewCompletionManager(func(Document) []Suggest { return suggests }, 6)
+	c.Update(Document{})
+	assert.Equal(t, CompletionLayoutList, c.Layout())
+
+	c.layout = CompletionLayoutGrid
+	c.Update(Document{})
+	assert.Equal(t, CompletionLayoutGrid, c.Layout())
+
+	// The list is used for the descriptions.
+	c.Next()
+	suggests = []Suggest{{Text: "a", Description: "the first"}}
+	c.Update(Document{})
+	assert.Equal(t, CompletionLayoutList, c.Layout())
+	assert.Equal(t, -1, c.selected)
+
+	// The layout is chosen for every result.
+	c.layoutFunc = func(d Document, s []Suggest) CompletionLayout {
+		if d.Text == "grid" {
+			return CompletionLayoutGrid
+		}
+		return CompletionLayoutList
+	}
+	suggests = []Suggest{{Text: "a"}, {Text: "b"}}
+	c.Update(Document{Text: "grid"})
+	assert.Equal(t, CompletionLayoutGrid, c.Layout())
+	c.Update(Document{Text: "list"})
+	assert.Equal(t, CompletionLayoutList, c.Layout())
+}
+
+func TestGroupSuggestions(t *testing.T) {
+	suggests := []Suggest{
+		{Text: "box", Group: "modules"},
+		{Text: "print", Group: "functions"},
+		{Text: "local"},
+		{Text: "json", Group: "modules"},
+		{Text: "pairs", Group: "functions"},
+	}
+	grouped, headers := groupSuggestions(suggests)
+	assert.Equal(t, []Suggest{
+		{Text: "local"},
+		{Text: "box", Group: "modules"},
+		{Text: "json", Group: "modules"},
+		{Text: "print", Group: "functions"},
+		{Text: "pairs", Group: "functions"},
+	}, grouped)
+	assert.Equal(t, []int{1, 3}, headers)
+
+	ungrouped := []Suggest{{Text: "a"}, {Text: "b"}}
+	grouped, headers = groupSuggestions(ungrouped)
+	assert.Equal(t, ungrouped, grouped)
+	assert.Nil(t, headers)
+}
+
+func TestCompletionGroupsNavigation(t *testing.T) {
+	c := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{
+			{Text: "a", Group: "first"},
+			{Text: "b", Group: "first"},
+			{Text: "c", Group: "second"},
+			{Text: "d", Group: "second"},
+		}
+	}, 3)
+	c.layout = CompletionLayoutGrid
+	c.Update(Document{})
+	assert.Equal(t, CompletionLayoutList, c.Layout(), "the groups are shown in the list")
+
+	rows, items := c.menuRows()
+	assert.Equal(t, []Suggest{
+		{Text: "first"},
+		{Text: "a", Group: "first"},
+		{Text: "b", Group: "first"},
+		{Text: "second"},
+		{Text: "c", Group: "second"},
+		{Text: "d", Group: "second"},
+	}, rows)
+	assert.Equal(t, []int{-1, 0, 1, -1, 2, 3}, items)
+
+	c.Next()
+	assert.Equal(t, 0, c.selected)
+	assert.Equal(t, 0, c.verticalScroll)
+	c.Next()
+	assert.Equal(t, 1, c.selected)
+	assert.Equal(t, 0, c.verticalScroll)
+
+	// The header of the group is shown with its first suggestion.
+	c.Next()
+	assert.Equal(t, 2, c.selected)
+	assert.Equal(t, 2, c.verticalScroll)
+	c.Next()
+	assert.Equal(t, 3, c.selected)
+	assert.Equal(t, 3, c.verticalScroll)
+	c.Next()
+	assert.Equal(t, -1, c.selected)
+	assert.Equal(t, 0, c.verticalScroll)
+
+	c.Previous()
+	assert.Equal(t, 3, c.selected)
+	assert.Equal(t, 3, c.verticalScroll)
+	c.Previous()
+	c.Previous()
+	assert.Equal(t, 1, c.selected)
+	assert.Equal(t, 2, c.verticalScroll)
+	c.Previous()
+	assert.Equal(t, 0, c.selected)
+	assert.Equal(t, 0, c.verticalScroll)
+}
+
+func TestCommonPrefix(t *testing.T) {
+	assert.Equal(t, "", commonPrefix(nil))
+	assert.Equal(t, "box", commonPrefix([]Suggest{{Text: "box"}}))
+	assert.Equal(t, "box.", commonPrefix([]Suggest{{Text: "box.cfg"}, {Text: "box.info"}}))
+	assert.Equal(t, "日本", commonPrefix([]Suggest{{Text: "日本語"}, {Text: "日本"}}))
+	assert.Equal(t, "", commonPrefix([]Suggest{{Text: "box"}, {Text: "json"}}))
+}
+
+func TestCompletionReplaceRange(t *testing.T) {
+	c := NewCompletionManager(nil, 6)
+	d := &Document{Text: "box.sp.x", cursorPosition: 6}
+
+	before, after := c.replaceRange(Suggest{Text: "space"}, d)
+	assert.Equal(t, 6, before)
+	assert.Equal(t, 0, after)
+
+	before, after = c.replaceRange(Suggest{Text: "space", Replace: &SuggestRange{Start: 4, End: 8}}, d)
+	assert.Equal(t, 2, before)
+	assert.Equal(t, 2, after)
+
+	// The range must contain the cursor.
+	before, after = c.replaceRange(Suggest{Text: "space", Replace: &SuggestRange{Start: 7, End: 9}}, d)
+	assert.Equal(t, 0, before)
+	assert.Equal(t, 0, after)
+}
+
+func TestCompletionReplaceRangeTokenizer(t *testing.T) {
+	c := NewCompletionManager(nil, 6)
+	c.tokenizer = ShellTokenizer{}
+	d := &Document{Text: `ls "my d" x`, cursorPosition: 7}
+
+	word, start := c.word(*d)
+	assert.Equal(t, "my ", word)
+	assert.Equal(t, 3, start)
+	assert.Equal(t, "ls ", c.wordPrefix(*d))
+
+	before, after := c.replaceRange(Suggest{Text: "my dir"}, d)
+	assert.Equal(t, 4, before)
+	assert.Equal(t, 2, after, "the rest of the token is replaced")
+	assert.Equal(t, `"my dir"`, c.quote("my dir", d, true))
+}
+
+func TestCompletionMatchHighlight(t *testing.T) {
+	c := NewCompletionManager(func(d Document) []Suggest {
+		return FilterFuzzyScored([]Suggest{
+			{Text: "box_info"},
+			{Text: "bi", Display: "bit.band"},
+		}, d.GetWordBeforeCursor(), true)
+	}, 6)
+	c.highlightMatches = true
+
+	c.Update(Document{Text: "bi", cursorPosition: 2})
+	assert.Equal(t, [][]int{{0, 1}, {0, 4}}, c.matches, "bit.band goes first")
+
+	c.Update(Document{Text: "", cursorPosition: 0})
+	assert.Nil(t, c.matches)
+}
+
+func TestCompletionDocumentation(t *testing.T) {
+	calls := 0
+	c := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "a", Documentation: "static"}, {Text: "b"}}
+	}, 6)
+	c.documentationFunc = func(s Suggest) string {
+		calls++
+		return "doc of " + s.Text
+	}
+	c.Update(Document{})
+	assert.Equal(t, "", c.documentation(), "nothing is selected")
+
+	c.Next()
+	assert.Equal(t, "static", c.documentation())
+	assert.Equal(t, 0, calls, "Suggest.Documentation has priority")
+
+	c.Next()
+	assert.Equal(t, "doc of b", c.documentation())
+	c.ScrollDocumentation(2)
+	assert.Equal(t, "doc of b", c.documentation())
+	assert.Equal(t, 1, calls, "the documentation is fetched once")
+	assert.Equal(t, 2, c.docScroll)
+
+	c.ScrollDocumentation(-5)
+	assert.Equal(t, 0, c.docScroll)
+
+	c.ScrollDocumentation(1)
+	c.Previous()
+	assert.Equal(t, "static", c.documentation())
+	assert.Equal(t, 0, c.docScroll, "the scroll is reset on a selection change")
+}
+
+func TestCompletionPaging(t *testing.T) {
+	suggests := make([]Suggest, 10)
+	for i := range suggests {
+		suggests[i] = Suggest{Text: string(rune('a' + i))}
+	}
+	c := NewCompletionManager(func(Document) []Suggest { return suggests }, 3)
+	c.Update(Document{})
+
+	c.PageDown()
+	assert.Equal(t, 2, c.selected)
+	assert.Equal(t, 0, c.verticalScroll)
+	c.PageDown()
+	assert.Equal(t, 5, c.selected)
+	assert.Equal(t, 3, c.verticalScroll)
+	c.Last()
+	assert.Equal(t, 9, c.selected)
+	assert.Equal(t, 7, c.verticalScroll)
+	c.PageDown()
+	assert.Equal(t, 9, c.selected, "the last suggestion is kept")
+	c.PageUp()
+	assert.Equal(t, 6, c.selected)
+	assert.Equal(t, 6, c.verticalScroll)
+	c.First()
+	assert.Equal(t, 0, c.selected)
+	assert.Equal(t, 0, c.verticalScroll)
+	c.PageUp()
+	assert.Equal(t, 0, c.selected)
+
+	selected, total := c.Position()
+	assert.Equal(t, 1, selected)
+	assert.Equal(t, 10, total)
+
+	// In the grid a page contains the visible rows.
+	c.layout = CompletionLayoutGrid
+	c.width = 14
+	c.Update(Document{})
+	require.True(t, c.grid)
+	c.PageDown()
+	assert.Equal(t, 12, c.pageSize(), "3 rows of 4 columns")
+	assert.Equal(t, 9, c.selected)
+}
+
+func TestCompletionCancel(t *testing.T) {
+	calls := 0
+	c := NewCompletionManager(func(Document) []Suggest {
+		calls++
+		return []Suggest{{Text: "a"}, {Text: "b"}}
+	}, 6)
+	c.Update(Document{Text: "x", cursorPosition: 1})
+	c.Next()
+	c.Cancel()
+	assert.False(t, c.Completing())
+	assert.False(t, c.shown())
+
+	// The menu is closed for the same document and the completer is not
+	// called.
+	c.Update(Document{Text: "x", cursorPosition: 1})
+	assert.False(t, c.shown())
+	assert.Equal(t, 1, calls)
+
+	// The menu is reopened by the selection.
+	c.Next()
+	assert.True(t, c.shown())
+	assert.Equal(t, 0, c.selected)
+
+	// The menu is reopened by the change of the document.
+	c.Cancel()
+	c.Update(Document{Text: "xy", cursorPosition: 2})
+	assert.True(t, c.shown())
+	assert.Equal(t, 2, calls)
+}
+
+func TestCompletionTrigger(t *testing.T) {
+	calls := 0
+	c := NewCompletionManager(func(Document) []Suggest {
+		calls++
+		return []Suggest{{Text: "info"}}
+	}, 6)
+	doc := func(text string) Document {
+		return Document{Text: text, cursorPosition: len([]rune(text))}
+	}
+
+	t.Run("tab", func(t *testing.T) {
+		calls = 0
+		c.trigger = CompletionTriggerTab
+		c.Update(doc("box.i"))
+		assert.Empty(t, c.GetSuggestions())
+		assert.Equal(t, 0, calls, "the completer is not called")
+
+		c.Trigger(doc("box.i"))
+		assert.Len(t, c.GetSuggestions(), 1)
+		c.Update(doc("box.in"))
+		assert.Len(t, c.GetSuggestions(), 1, "the word is continued")
+		assert.Equal(t, 2, calls)
+
+		c.Update(doc("box.in "))
+		assert.Empty(t, c.GetSuggestions(), "the word is left")
+		c.Update(doc("box.in"))
+		assert.Empty(t, c.GetSuggestions())
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		c.trigger = CompletionTriggerAuto
+		c.minLength = 3
+		c.triggerCharacters = ".:"
+		for text, shown := range map[string]bool{
+			"":         false,
+			"bo":       false,
+			"box":      true,
+			"x bo":     false,
+			"b.":       true,
+			"b:s":      true,
+			"b:s info": true,
+			"b:s in":   false,
+		} {
+			c.Update(doc(text))
+			assert.Equal(t, shown, len(c.GetSuggestions()) > 0, text)
+		}
+
+		// The trigger character before the word separator.
+		c.wordSeparator = " .:"
+		c.minLength = 0
+		c.Update(doc("box.s"))
+		assert.Len(t, c.GetSuggestions(), 1)
+		c.Update(doc("box s"))
+		assert.Empty(t, c.GetSuggestions())
+	})
+}
+
+func TestCompletionHeight(t *testing.T) {
+	suggests := make([]Suggest, 10)
+	for i := range suggests {
+		suggests[i] = Suggest{Text: string(rune('a' + i))}
+	}
+	c := NewCompletionManager(func(Document) []Suggest { return suggests }, 3)
+	c.Update(Document{})
+	c.Last()
+	assert.Equal(t, 7, c.verticalScroll)
+
+	// The scroll is kept in the bounds.
+	c.setHeight(5)
+	assert.Equal(t, 5, c.verticalScroll)
+	c.PageUp()
+	assert.Equal(t, 4, c.selected)
+
+	// The selected suggestion is kept visible.
+	c.setHeight(2)
+	assert.Equal(t, 4, c.verticalScroll)
+	c.setHeight(0)
+	assert.Equal(t, 3, c.visibleRows())
+}
@@ -174,6 +174,58 @@ func (d *Document) FindWordEndForwardCursor(isWordPart func(rune) bool) int {
 	return d.cursorPosition + cursor
 }
 
+// GetTokenBeforeCursor returns the token of the tokenizer ending at the
+// cursor, its value is the part before the cursor. The token is empty and
+// starts at the cursor if there is no such token.
+func (d *Document) GetTokenBeforeCursor(t Tokenizer) Token {
+	before := d.TextBeforeCursor()
+	cursor := len([]rune(before))
+	tokens := t.Tokenize(before)
+	if n := len(tokens); n > 0 && tokens[n-1].End == cursor {
+		return tokens[n-1]
+	}
+	return Token{Start: cursor, End: cursor}
+}
+
+// GetTokenAtCursor is almost the same as GetTokenBeforeCursor, but the token
+// includes the part after the cursor.
+func (d *Document) GetTokenAtCursor(t Tokenizer) Token {
+	token := d.GetTokenBeforeCursor(t)
+	if token.Start == token.End {
+		return token
+	}
+	for _, full := range t.Tokenize(d.Text) {
+		if full.Start == token.Start {
+			return full
+		}
+	}
+	return token
+}
+
+// FindTokenStartBackwardCursor finds the start of the token of the tokenizer
+// moving backward, returns the associated cursor position.
+func (d *Document) FindTokenStartBackwardCursor(t Tokenizer) int {
+	cursor := len([]rune(d.TextBeforeCursor()))
+	tokens := t.Tokenize(d.TextBeforeCursor())
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].Start < cursor {
+			return tokens[i].Start
+		}
+	}
+	return 0
+}
+
+// FindTokenEndForwardCursor finds the end of the token of the tokenizer
+// moving forward, returns the cursor position exactly after the end.
+func (d *Document) FindTokenEndForwardCursor(t Tokenizer) int {
+	for _, token := range t.Tokenize(d.Text) {
+		if token.End > d.cursorPosition {
+			return token.End
+		}
+	}
+	return len([]rune(d.Text))
+}
+
 // FindStartOfPreviousWordWithSpace is almost the same as FindStartOfPreviousWord.
 // The only difference is to ignore contiguous spaces.
 func (d *Document) FindStartOfPreviousWordWithSpace() int {
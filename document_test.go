@@ -1586,3 +1586,31 @@ func TestFindWordEndForwardCursor(t *testing.T) {
 		})
 	}
 }
+
+func TestGetTokenBeforeCursor(t *testing.T) {
+	d := &Document{Text: `ls "my dir/file" x`, cursorPosition: 10}
+	assert.Equal(t, Token{Start: 3, End: 10, Value: "my dir", Quote: '"'},
+		d.GetTokenBeforeCursor(ShellTokenizer{}))
+	assert.Equal(t, Token{Start: 3, End: 16, Value: "my dir/file", Quote: '"'},
+		d.GetTokenAtCursor(ShellTokenizer{}))
+
+	// There is no token before the cursor at the start of a token.
+	d = &Document{Text: "ls x", cursorPosition: 3}
+	assert.Equal(t, Token{Start: 3, End: 3}, d.GetTokenBeforeCursor(ShellTokenizer{}))
+	assert.Equal(t, Token{Start: 3, End: 3}, d.GetTokenAtCursor(ShellTokenizer{}))
+}
+
+func TestFindTokenCursor(t *testing.T) {
+	d := &Document{Text: `box.space['my space']:select`, cursorPosition: 21}
+	assert.Equal(t, 10, d.FindTokenStartBackwardCursor(LuaTokenizer{}))
+	assert.Equal(t, 28, d.FindTokenEndForwardCursor(LuaTokenizer{}))
+
+	d = &Document{Text: `ls  "a b"  `, cursorPosition: 0}
+	assert.Equal(t, 0, d.FindTokenStartBackwardCursor(ShellTokenizer{}))
+	assert.Equal(t, 2, d.FindTokenEndForwardCursor(ShellTokenizer{}))
+	d.cursorPosition = 2
+	assert.Equal(t, 9, d.FindTokenEndForwardCursor(ShellTokenizer{}))
+	d.cursorPosition = 11
+	assert.Equal(t, 4, d.FindTokenStartBackwardCursor(ShellTokenizer{}))
+	assert.Equal(t, 11, d.FindTokenEndForwardCursor(ShellTokenizer{}))
+}
@@ -17,6 +17,7 @@ Moving the cursor
 * [x] Ctrl + n   Next command (Down arrow)
 * [x] Ctrl + f   Forward one character
 * [x] Ctrl + b   Backward one character
+* [x] Alt  + f   Forward one word
 * [x] Ctrl + xx  Toggle between the start of line and current cursor position
 
 Editing
@@ -36,6 +37,14 @@ Editing
 * [ ] ctrl + y   Paste the last thing to be cut (yank).
 * [ ] ctrl + _   Undo.
 
+History
+-------
+
+* [x] Ctrl + o   Execute the command and load the next history entry.
+* [x] Alt  + .   Insert the last word of the previous command (Alt + _).
+* [x] Alt  + <   Go to the first history entry.
+* [x] Alt  + >   Go to the input line.
+
 */
 
 var emacsKeyBindings = []KeyBind{
@@ -91,13 +100,46 @@ var emacsKeyBindings = []KeyBind{
 		Key: ControlB,
 		Fn:  GoLeftChar,
 	},
+	// Go to the end of the next word.
+	{
+		Key: AltF,
+		Fn:  GoRightWord,
+	},
 	// Cut the Word before the cursor.
 	{
 		Key: ControlW,
 		Fn: func(buf *Buffer) {
+			if buf.tokenizer != nil {
+				DeleteWord(buf)
+				return
+			}
 			buf.DeleteBeforeCursor(len([]rune(buf.Document().GetWordBeforeCursorWithSpace())))
 		},
 	},
+	// Accept the command and load the next history entry.
+	{
+		Key: ControlO,
+		Fn:  OperateAndGetNext,
+	},
+	// Insert the last word of the previous command.
+	{
+		Key: AltDot,
+		Fn:  YankLastArg,
+	},
+	{
+		Key: AltUnderscore,
+		Fn:  YankLastArg,
+	},
+	// Go to the first history entry.
+	{
+		Key: AltLessThan,
+		Fn:  BeginningOfHistory,
+	},
+	// Go to the input line.
+	{
+		Key: AltGreaterThan,
+		Fn:  EndOfHistory,
+	},
 	// Clear the Screen, similar to the clear command
 	{
 		Key: ControlL,
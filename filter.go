@@ -1,6 +1,38 @@
 package prompt
 
-import "strings"
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores of the fuzzy matching.
+const (
+	// fuzzyScoreMatch is the score of a matched rune.
+	fuzzyScoreMatch = 16
+	// fuzzyBonusPrefix is the bonus for a match at the beginning of the text.
+	fuzzyBonusPrefix = 12
+	// fuzzyBonusBoundary is the bonus for a match at the beginning of a word.
+	fuzzyBonusBoundary = 8
+	// fuzzyBonusCamel is the bonus for an upper case match after a lower case rune.
+	fuzzyBonusCamel = 7
+	// fuzzyBonusConsecutive is the minimal bonus for a match right after
+	// the previous one. Consecutive matches share the bonus of the first one.
+	fuzzyBonusConsecutive = 4
+	// fuzzyPenaltyGapStart is the penalty for a gap between the matches.
+	fuzzyPenaltyGapStart = 3
+	// fuzzyPenaltyGapExtension is the penalty for every rune of the gap after the first one.
+	fuzzyPenaltyGapExtension = 1
+)
+
+// FuzzyMatch is a suggestion fuzzy matched by a query.
+type FuzzyMatch struct {
+	Suggest Suggest
+	// Score is greater for better matches.
+	Score int
+	// Positions are the positions of the matched runes in Suggest.Text.
+	Positions []int
+}
 
 // Filter is the type to filter the prompt.Suggestion array.
 type Filter func([]Suggest, string, bool) []Suggest
@@ -27,6 +59,142 @@ func FilterFuzzy(completions []Suggest, sub string, ignoreCase bool) []Suggest {
 	return filterSuggestions(completions, sub, ignoreCase, fuzzyMatch)
 }
 
+// FilterFuzzyScored returns the suggestions fuzzy matched by sub like
+// FilterFuzzy, but sorted from the best match as RankFuzzy does.
+func FilterFuzzyScored(completions []Suggest, sub string, ignoreCase bool) []Suggest {
+	matches := RankFuzzy(completions, sub, ignoreCase)
+	ret := make([]Suggest, len(matches))
+	for i, m := range matches {
+		ret[i] = m.Suggest
+	}
+	return ret
+}
+
+// RankFuzzy returns the suggestions fuzzy matched by sub sorted by the score
+// from the best match, the suggestions with equal scores keep their order.
+// Matches at the beginning of the text and of words, camelCase humps and
+// consecutive matches score higher, gaps between the matches score lower.
+func RankFuzzy(completions []Suggest, sub string, ignoreCase bool) []FuzzyMatch {
+	matches := make([]FuzzyMatch, 0, len(completions))
+	for _, c := range completions {
+		if score, positions, ok := FuzzyScore(c.Text, sub, ignoreCase); ok {
+			matches = append(matches, FuzzyMatch{Suggest: c, Score: score, Positions: positions})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+// FuzzyScore fuzzy matches s by sub and returns the best score with
+// the positions of the matched runes of s, ok is false if s does not match.
+// The empty sub matches any string with the zero score.
+func FuzzyScore(s, sub string, ignoreCase bool) (score int, positions []int, ok bool) {
+	text := []rune(s)
+	query := []rune(sub)
+	if len(query) == 0 {
+		return 0, []int{}, true
+	}
+	if len(query) > len(text) {
+		return 0, nil, false
+	}
+	equal := func(a, b rune) bool {
+		if ignoreCase {
+			return unicode.ToLower(a) == unicode.ToLower(b)
+		}
+		return a == b
+	}
+
+	// scores[j][i] is the best score of the query prefix [0, j] with
+	// the j-th rune matched at i, from[j][i] is the previous match then.
+	// chunks[j][i] is the bonus of the first match of the consecutive ones.
+	const none = -1 << 30
+	scores := make([][]int, len(query))
+	from := make([][]int, len(query))
+	chunks := make([][]int, len(query))
+	for j := range query {
+		scores[j] = make([]int, len(text))
+		from[j] = make([]int, len(text))
+		chunks[j] = make([]int, len(text))
+		// best is the best score of the previous rune matched at k <= i-2
+		// plus the gap extension penalty for k runes, so the penalty for
+		// the gap from k to i does not depend on k.
+		best, bestIndex := none, -1
+		for i := range text {
+			scores[j][i] = none
+			if k := i - 2; j > 0 && k >= 0 && scores[j-1][k] != none &&
+				scores[j-1][k]+k*fuzzyPenaltyGapExtension > best {
+				best, bestIndex = scores[j-1][k]+k*fuzzyPenaltyGapExtension, k
+			}
+			if !equal(query[j], text[i]) {
+				continue
+			}
+			bonus := fuzzyBonus(text, i)
+			if j == 0 {
+				scores[j][i] = fuzzyScoreMatch + bonus
+				chunks[j][i] = bonus
+				continue
+			}
+			if i > 0 && scores[j-1][i-1] != none {
+				chunk := chunks[j-1][i-1]
+				if chunk < fuzzyBonusConsecutive {
+					chunk = fuzzyBonusConsecutive
+				}
+				consecutive := bonus
+				if consecutive < chunk {
+					consecutive = chunk
+				}
+				scores[j][i] = scores[j-1][i-1] + fuzzyScoreMatch + consecutive
+				from[j][i] = i - 1
+				chunks[j][i] = chunk
+			}
+			if best != none {
+				gapped := best - fuzzyPenaltyGapStart -
+					(i-2)*fuzzyPenaltyGapExtension + fuzzyScoreMatch + bonus
+				if gapped > scores[j][i] {
+					scores[j][i] = gapped
+					from[j][i] = bestIndex
+					chunks[j][i] = bonus
+				}
+			}
+		}
+	}
+
+	last := len(query) - 1
+	end := -1
+	for i := range text {
+		if scores[last][i] != none && (end == -1 || scores[last][i] > scores[last][end]) {
+			end = i
+		}
+	}
+	if end == -1 {
+		return 0, nil, false
+	}
+	positions = make([]int, len(query))
+	for j, i := last, end; j >= 0; j-- {
+		positions[j] = i
+		i = from[j][i]
+	}
+	return scores[last][end], positions, true
+}
+
+// fuzzyBonus returns the bonus for the match of the i-th rune of the text.
+func fuzzyBonus(text []rune, i int) int {
+	if i == 0 {
+		return fuzzyBonusPrefix
+	}
+	prev, cur := text[i-1], text[i]
+	switch {
+	case !unicode.IsLetter(prev) && !unicode.IsDigit(prev) &&
+		(unicode.IsLetter(cur) || unicode.IsDigit(cur)):
+		return fuzzyBonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return fuzzyBonusCamel
+	}
+	return 0
+}
+
 func fuzzyMatch(s, sub string) bool {
 	sChars := []rune(s)
 	sIdx := 0
@@ -48,6 +216,32 @@ func fuzzyMatch(s, sub string) bool {
 	return true
 }
 
+// fuzzyMatchPositions returns the positions of the runes of s fuzzy matched
+// by sub, ok is false if s does not match.
+func fuzzyMatchPositions(s, sub string, ignoreCase bool) (positions []int, ok bool) {
+	equal := func(a, b rune) bool {
+		if ignoreCase {
+			// The runes are compared one by one, because the lower case
+			// of a string may have another number of runes.
+			return unicode.ToLower(a) == unicode.ToLower(b)
+		}
+		return a == b
+	}
+	sChars := []rune(s)
+	positions = make([]int, 0, len(sub))
+	sIdx := 0
+	for _, c := range sub {
+		for ; sIdx < len(sChars) && !equal(sChars[sIdx], c); sIdx++ {
+		}
+		if sIdx == len(sChars) {
+			return nil, false
+		}
+		positions = append(positions, sIdx)
+		sIdx++
+	}
+	return positions, true
+}
+
 func filterSuggestions(
 	suggestions []Suggest,
 	sub string,
@@ -3,6 +3,8 @@ package prompt
 import (
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestFilter(t *testing.T) {
@@ -164,3 +166,97 @@ func TestFuzzyMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestFuzzyMatchPositions(t *testing.T) {
+	tests := []struct {
+		s          string
+		sub        string
+		ignoreCase bool
+		positions  []int
+		match      bool
+	}{
+		{"dog house", "dog", false, []int{0, 1, 2}, true},
+		{"dog house", "", false, []int{}, true},
+		{"dog house", "DH", false, nil, false},
+		{"dog house", "DH", true, []int{0, 4}, true},
+		{"this is much longer", "hhg", false, []int{1, 11, 16}, true},
+		{"unicode 文字 with 今日", "文日", false, []int{8, 17}, true},
+		{"İstanbul", "STA", true, []int{1, 2, 3}, true},
+		{"Ünİcode", "üNİC", true, []int{0, 1, 2, 3}, true},
+		{"long", "longer", false, nil, false},
+	}
+
+	for _, test := range tests {
+		positions, ok := fuzzyMatchPositions(test.s, test.sub, test.ignoreCase)
+		if ok != test.match || !reflect.DeepEqual(positions, test.positions) {
+			t.Errorf("fuzzyMatchPositions, %s in %s: expected %v %v, got %v %v",
+				test.sub, test.s, test.positions, test.match, positions, ok)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	cases := []struct {
+		name       string
+		s          string
+		sub        string
+		ignoreCase bool
+		positions  []int
+		ok         bool
+	}{
+		{name: "empty", s: "abc", sub: "", positions: []int{}, ok: true},
+		{name: "word boundary", s: "foo_bar", sub: "fb", positions: []int{0, 4}, ok: true},
+		{name: "camel case", s: "fooBar", sub: "fB", positions: []int{0, 3}, ok: true},
+		{name: "consecutive", s: "a_b_abc", sub: "abc", positions: []int{4, 5, 6}, ok: true},
+		{name: "case", s: "fooBar", sub: "fb", ok: false},
+		{name: "ignore case", s: "fooBar", sub: "fb", ignoreCase: true, positions: []int{0, 3}, ok: true},
+		{name: "unicode", s: "日本語", sub: "本語", positions: []int{1, 2}, ok: true},
+		{name: "no match", s: "abc", sub: "abd", ok: false},
+		{name: "too long", s: "ab", sub: "abc", ok: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, positions, ok := FuzzyScore(tc.s, tc.sub, tc.ignoreCase)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.positions, positions)
+		})
+	}
+
+	prefix, _, _ := FuzzyScore("bar_baz", "bar", false)
+	inner, _, _ := FuzzyScore("foobar", "bar", false)
+	boundary, _, _ := FuzzyScore("foo_bar", "bar", false)
+	gap, _, _ := FuzzyScore("b_a_r", "bar", false)
+	assert.Greater(t, prefix, boundary)
+	assert.Greater(t, boundary, gap)
+	assert.Greater(t, gap, inner)
+}
+
+func TestRankFuzzy(t *testing.T) {
+	completions := []Suggest{
+		{Text: "b_a_r"},
+		{Text: "foobar"},
+		{Text: "baz"},
+		{Text: "bar_baz"},
+		{Text: "foo_bar"},
+		{Text: "foo.bar"},
+	}
+
+	matches := RankFuzzy(completions, "bar", false)
+	assert.Equal(t, []FuzzyMatch{
+		{Suggest: Suggest{Text: "bar_baz"}, Score: 84, Positions: []int{0, 1, 2}},
+		{Suggest: Suggest{Text: "foo_bar"}, Score: 72, Positions: []int{4, 5, 6}},
+		{Suggest: Suggest{Text: "foo.bar"}, Score: 72, Positions: []int{4, 5, 6}},
+		{Suggest: Suggest{Text: "b_a_r"}, Score: 70, Positions: []int{0, 2, 4}},
+		{Suggest: Suggest{Text: "foobar"}, Score: 56, Positions: []int{3, 4, 5}},
+	}, matches)
+
+	assert.Equal(t, []Suggest{
+		{Text: "bar_baz"},
+		{Text: "foo_bar"},
+		{Text: "foo.bar"},
+		{Text: "b_a_r"},
+		{Text: "foobar"},
+	}, FilterFuzzyScored(completions, "bar", false))
+	assert.Equal(t, completions, FilterFuzzyScored(completions, "", false))
+}
@@ -1,25 +1,322 @@
 package prompt
 
-import "strings"
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tarantool/go-prompt/internal/debug"
+)
+
+// HistoryShareMode defines how entries, appended to a shared history store
+// by other sessions, are merged into the history.
+type HistoryShareMode int
+
+const (
+	// HistoryShareDisabled disables merging, entries of other sessions
+	// are loaded only at start.
+	HistoryShareDisabled HistoryShareMode = iota
+	// HistoryShareChronological merges entries of all sessions in the order
+	// they were appended to the store, like zsh SHARE_HISTORY.
+	HistoryShareChronological
+	// HistoryShareLocalFirst puts entries of other sessions before the entries
+	// of the current session, so the own commands are the nearest on navigation.
+	HistoryShareLocalFirst
+)
+
+// DefaultHistoryNamespace is the name of the default history namespace.
+const DefaultHistoryNamespace = ""
+
+// HistoryEntry is a command stored in the history with its metadata.
+// Metadata fields are optional and may be empty.
+type HistoryEntry struct {
+	// Text is the command text.
+	Text string
+	// Time is the moment, when the command was entered.
+	Time time.Time
+	// Duration is the time spent on the command execution.
+	Duration time.Duration
+	// Status is an arbitrary status or tag of the command, set by the executor.
+	Status string
+	// Dir is the working directory, where the command was entered.
+	Dir string
+}
+
+// NewHistoryEntry returns a new entry with the current time and working directory.
+func NewHistoryEntry(text string) HistoryEntry {
+	dir, _ := os.Getwd()
+	return HistoryEntry{
+		Text: text,
+		Time: time.Now(),
+		Dir:  dir,
+	}
+}
 
 // History stores the texts that are entered.
 type History struct {
-	histories []string
+	histories []HistoryEntry
 	tmp       []string
 	selected  int
+
+	// store is a persistent storage of the history, nil if not used.
+	store HistoryStore
+	// shareMode defines merging of entries appended to the store by other sessions.
+	shareMode HistoryShareMode
+	// onStoreError is called with the errors of the store, if it is set.
+	onStoreError func(error)
+	// sessionStart is the index of the first entry added in the current session.
+	sessionStart int
+	// storeSize is the number of entries in the store known to the history.
+	storeSize int
+	// policy defines which entries are kept in the history.
+	policy HistoryPolicy
+	// executing is the index of the entry, which is being executed and
+	// whose results will be persisted after the execution, -1 if there is
+	// no such entry.
+	executing int
+	// started is the start of the execution of the executing entry.
+	started time.Time
+	// finishOnStatus is true if the executing entry is finished by setStatus,
+	// because its execution is not observed by the prompt.
+	finishOnStatus bool
+	// next is the entry to load after the execution by OperateAndGetNext.
+	next historyNext
+	// yank is the state of the last YankLastArg call.
+	yank historyYank
+}
+
+// historyNext describes the history entry, which is next to the accepted one.
+type historyNext struct {
+	// requested is true if the entry should be loaded.
+	requested bool
+	// text is the entry text.
+	text string
+	// fromEnd is the number of the entries after the next one.
+	fromEnd int
+}
+
+// historyYank describes the word inserted by YankLastArg.
+type historyYank struct {
+	// index is the index of the entry, which the word is taken from.
+	index int
+	// word is the inserted word.
+	word string
+	// text and cursor are the buffer state after the insertion,
+	// they are used to detect a repeated call.
+	text   string
+	cursor int
 }
 
-// Add to add text in history.
+// Add to add text in history, if it is accepted by the history policy.
+// The text is appended to the history store, if it is set.
 func (h *History) Add(input string) {
-	h.histories = append(h.histories, input)
+	h.AddEntry(NewHistoryEntry(input))
+}
+
+// AddEntry adds an entry with its metadata in history, if it is accepted
+// by the history policy. The entry is appended to the history store, if it is set.
+func (h *History) AddEntry(entry HistoryEntry) {
+	h.merge(h.loadShared())
+	if h.push(entry) {
+		h.persist(entry)
+	}
+	h.Clear()
+}
+
+// Entries returns a copy of the history entries from the oldest to the newest.
+func (h *History) Entries() []HistoryEntry {
+	entries := make([]HistoryEntry, len(h.histories))
+	copy(entries, h.histories)
+	return entries
+}
+
+// entry returns the history entry with the index in the current history
+// state, ok is false for the current command.
+func (h *History) entry(index int) (entry HistoryEntry, ok bool) {
+	if index < 0 || index >= len(h.histories) {
+		return HistoryEntry{}, false
+	}
+	return h.histories[index], true
+}
+
+// suggest returns the rest of the newest entry, which starts with the prefix
+// and is longer than it, empty if there is no such entry.
+func (h *History) suggest(prefix string) string {
+	for i := len(h.histories) - 1; i >= 0; i-- {
+		text := h.histories[i].Text
+		if len(text) > len(prefix) && strings.HasPrefix(text, prefix) {
+			return text[len(prefix):]
+		}
+	}
+	return ""
+}
+
+// start adds an entry, which is going to be executed, and persists it.
+// The execution results are stored by the finish call.
+func (h *History) start(entry HistoryEntry) {
+	h.merge(h.loadShared())
+	h.executing, h.started, h.finishOnStatus = -1, time.Now(), false
+	if h.push(entry) {
+		h.executing = len(h.histories) - 1
+		h.persist(entry)
+	}
+	h.Clear()
+}
+
+// setStatus sets the status of the entry, which is being executed.
+// The entry is finished, if finishOnStatus is set.
+func (h *History) setStatus(status string) {
+	if h.executing == -1 {
+		return
+	}
+	h.histories[h.executing].Status = status
+	if h.finishOnStatus {
+		h.finish(time.Since(h.started))
+	}
+}
+
+// finish sets the execution duration of the entry added by start and
+// persists the execution results, if the store is an UpdatableHistoryStore.
+func (h *History) finish(duration time.Duration) {
+	if h.executing == -1 {
+		return
+	}
+	h.histories[h.executing].Duration = duration
+	entry := h.histories[h.executing]
+	h.executing = -1
+
+	store, ok := h.store.(UpdatableHistoryStore)
+	if !ok || (entry.Duration == 0 && entry.Status == "") {
+		return
+	}
+	if err := store.Update(entry); err != nil {
+		h.storeError(fmt.Errorf("cannot update the entry in the store: %w", err))
+	}
+}
+
+// persist appends an entry to the history store, if it is set.
+func (h *History) persist(entry HistoryEntry) {
+	if h.store == nil {
+		return
+	}
+	if err := h.store.Append(entry); err != nil {
+		h.storeError(fmt.Errorf("cannot append to the store: %w", err))
+	} else {
+		h.storeSize++
+	}
+	// Entries removed by the policy stay in the store until compaction,
+	// so compact it when it becomes twice as large as the history.
+	// A SharedHistoryStore keeps entries of other sessions on compaction.
+	if h.storeSize > 2*len(h.histories) {
+		if err := h.compact(); err != nil {
+			h.storeError(fmt.Errorf("cannot compact the store: %w", err))
+		}
+	}
+}
+
+// storeError reports the error of the history store.
+func (h *History) storeError(err error) {
+	debug.Log("history: " + err.Error())
+	if h.onStoreError != nil {
+		h.onStoreError(err)
+	}
+}
+
+// load loads entries from the history store and puts them
+// before the entries already present in the history.
+// All the entries are filtered by the history policy.
+// If the store cannot be loaded, it is not used anymore and the history
+// is kept in memory, the error is returned.
+func (h *History) load() error {
+	var entries []HistoryEntry
+	var err error
+	if h.store != nil {
+		if entries, err = h.store.Load(); err != nil {
+			h.store = nil
+			entries = nil
+		}
+	}
+	h.storeSize = len(entries)
+
+	entries = append(entries, h.histories...)
+	h.histories = make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		h.push(entry)
+	}
+	h.sessionStart = len(h.histories)
+	h.Clear()
+	return err
+}
+
+// loadShared returns entries appended to the store by other sessions
+// if the sharing is enabled.
+func (h *History) loadShared() []HistoryEntry {
+	store, ok := h.store.(SharedHistoryStore)
+	if !ok || h.shareMode == HistoryShareDisabled {
+		return nil
+	}
+	entries, err := store.LoadNew()
+	if err != nil {
+		h.storeError(fmt.Errorf("cannot load new entries from the store: %w", err))
+		return nil
+	}
+	return entries
+}
+
+// merge inserts entries of other sessions according to the share mode.
+// The history state must be cleared after that.
+func (h *History) merge(entries []HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	h.storeSize += len(entries)
+	if h.shareMode == HistoryShareLocalFirst {
+		merged := make([]HistoryEntry, 0, len(h.histories)+len(entries))
+		merged = append(merged, h.histories[:h.sessionStart]...)
+		merged = append(merged, entries...)
+		merged = append(merged, h.histories[h.sessionStart:]...)
+		h.histories = merged
+		h.sessionStart += len(entries)
+	} else {
+		h.histories = append(h.histories, entries...)
+	}
+	h.evict()
+}
+
+// sync merges entries appended to the store by other sessions.
+// It does nothing while some entry is selected to keep the navigation state.
+func (h *History) sync() {
+	if h.selected != len(h.tmp)-1 {
+		return
+	}
+	entries := h.loadShared()
+	if len(entries) == 0 {
+		return
+	}
+	current := h.tmp[h.selected]
+	h.merge(entries)
 	h.Clear()
+	h.tmp[h.selected] = current
+}
+
+// compact replaces the content of the history store with the current entries.
+func (h *History) compact() error {
+	if h.store == nil {
+		return nil
+	}
+	if err := h.store.Compact(h.histories); err != nil {
+		return err
+	}
+	h.storeSize = len(h.histories)
+	return nil
 }
 
 // Clear to clear the history.
 func (h *History) Clear() {
 	h.tmp = make([]string, len(h.histories))
 	for i := range h.histories {
-		h.tmp[i] = h.histories[i]
+		h.tmp[i] = h.histories[i].Text
 	}
 	h.tmp = append(h.tmp, "")
 	h.selected = len(h.tmp) - 1
@@ -28,6 +325,7 @@ func (h *History) Clear() {
 // Older saves a buffer of current line and get a buffer of previous line by up-arrow.
 // The changes of line buffers are stored until new history is created.
 func (h *History) Older(buf *Buffer) (new *Buffer, changed bool) {
+	h.sync()
 	if len(h.tmp) == 1 || h.selected == 0 {
 		return buf, false
 	}
@@ -53,6 +351,159 @@ func (h *History) Newer(buf *Buffer) (new *Buffer, changed bool) {
 	return new, true
 }
 
+// Oldest saves a buffer of current line and get a buffer of the first line.
+// The changes of line buffers are stored until new history is created.
+func (h *History) Oldest(buf *Buffer) (new *Buffer, changed bool) {
+	h.sync()
+	return h.moveTo(buf, 0)
+}
+
+// Newest saves a buffer of current line and get a buffer of the line,
+// which is being entered.
+// The changes of line buffers are stored until new history is created.
+func (h *History) Newest(buf *Buffer) (new *Buffer, changed bool) {
+	return h.moveTo(buf, len(h.tmp)-1)
+}
+
+// moveTo saves a buffer of current line and selects the line with the index.
+func (h *History) moveTo(buf *Buffer, index int) (new *Buffer, changed bool) {
+	if h.selected == index {
+		return buf, false
+	}
+	h.tmp[h.selected] = buf.Text()
+
+	h.selected = index
+	new = NewBuffer()
+	new.InsertText(h.tmp[h.selected], false, true)
+	return new, true
+}
+
+// requestNext remembers the entry next to the selected one
+// to load it after the execution of the accepted command.
+func (h *History) requestNext(accepted string) {
+	h.next = historyNext{}
+	index := h.selected + 1
+	if index > len(h.histories) {
+		return
+	}
+	h.next = historyNext{
+		requested: true,
+		text:      accepted,
+		fromEnd:   len(h.histories) - index,
+	}
+	if index < len(h.histories) {
+		h.next.text = h.histories[index].Text
+	}
+}
+
+// takeNext returns a buffer of the line requested by requestNext and selects it.
+// The entry is searched by its text, because the accepted entry may be added
+// to the history or may remove other entries.
+func (h *History) takeNext() (new *Buffer, ok bool) {
+	next := h.next
+	h.next = historyNext{}
+	if !next.requested {
+		return nil, false
+	}
+	h.Clear()
+
+	found := -1
+	for _, i := range []int{len(h.histories) - next.fromEnd - 1, len(h.histories) - next.fromEnd} {
+		if i >= 0 && i < len(h.histories) && h.histories[i].Text == next.text {
+			found = i
+			break
+		}
+	}
+	for i := len(h.histories) - 1; found == -1 && i >= 0; i-- {
+		if h.histories[i].Text == next.text {
+			found = i
+		}
+	}
+	if found == -1 {
+		return nil, false
+	}
+
+	h.selected = found
+	new = NewBuffer()
+	new.InsertText(h.tmp[h.selected], false, true)
+	return new, true
+}
+
+// yankLastArg inserts the last word of the previous entry at the cursor.
+// If the previous call inserted a word and the buffer was not changed after that,
+// the word is replaced with the last word of the entry before the previous one.
+func (h *History) yankLastArg(buf *Buffer) {
+	index := len(h.histories) - 1
+	repeated := h.yank.word != "" && h.yank.text == buf.Text() &&
+		h.yank.cursor == buf.cursorPosition
+	if repeated {
+		index = h.yank.index - 1
+	}
+
+	for ; index >= 0; index-- {
+		words := splitHistoryWords(h.histories[index].Text)
+		if len(words) == 0 {
+			continue
+		}
+		if repeated {
+			buf.DeleteBeforeCursor(len([]rune(h.yank.word)))
+		}
+		word := words[len(words)-1]
+		buf.InsertText(word, false, true)
+		h.yank = historyYank{
+			index:  index,
+			word:   word,
+			text:   buf.Text(),
+			cursor: buf.cursorPosition,
+		}
+		return
+	}
+}
+
+// OlderWithPrefix is like Older, but gets a buffer of the nearest previous line,
+// which starts with the text before the cursor. The cursor position is kept.
+// If the text before the cursor is empty, it is the same as Older.
+func (h *History) OlderWithPrefix(buf *Buffer) (new *Buffer, changed bool) {
+	return h.moveWithPrefix(buf, -1)
+}
+
+// NewerWithPrefix is like Newer, but gets a buffer of the nearest next line,
+// which starts with the text before the cursor. The cursor position is kept.
+// If the text before the cursor is empty, it is the same as Newer.
+func (h *History) NewerWithPrefix(buf *Buffer) (new *Buffer, changed bool) {
+	return h.moveWithPrefix(buf, 1)
+}
+
+// moveWithPrefix selects the nearest line in the direction of step,
+// which starts with the text before the cursor and differs from the current one.
+// The current input line is always matched.
+func (h *History) moveWithPrefix(buf *Buffer, step int) (new *Buffer, changed bool) {
+	prefix := buf.Document().TextBeforeCursor()
+	if prefix == "" {
+		if step < 0 {
+			return h.Older(buf)
+		}
+		return h.Newer(buf)
+	}
+
+	h.sync()
+	last := len(h.tmp) - 1
+	for i := h.selected + step; i >= 0 && i <= last; i += step {
+		if i != last && (!strings.HasPrefix(h.tmp[i], prefix) || h.tmp[i] == buf.Text()) {
+			continue
+		}
+		h.tmp[h.selected] = buf.Text()
+		h.selected = i
+
+		new = NewBuffer()
+		new.InsertText(h.tmp[h.selected], false, true)
+		// The input line may be shorter than the prefix.
+		new.setCursorPosition(minInt(len([]rune(prefix)), len([]rune(h.tmp[h.selected]))))
+		return new, true
+	}
+	return buf, false
+}
+
 // SetCurrentCmd sets current command.
 func (h *History) SetCurrentCmd(cmd string) {
 	h.tmp[h.selected] = cmd
@@ -61,19 +512,35 @@ func (h *History) SetCurrentCmd(cmd string) {
 // FindMatch finds last match of input in the specified prefix
 // in current history state.
 func (h *History) FindMatch(input string, prefix int) int {
-	for i := prefix; i >= 0; i-- {
-		if strings.Contains(h.tmp[i], input) {
+	return h.findMatch(newSearchMatcher(input, false, false), prefix, -1)
+}
+
+// findMatch finds the nearest line in the current history state, which
+// is matched by match, starting from the index in the direction of step.
+func (h *History) findMatch(match searchMatcher, from int, step int) int {
+	for i := from; i >= 0 && i < len(h.tmp); i += step {
+		if start, _ := match(h.tmp[i]); start != -1 {
 			return i
 		}
 	}
 	return -1
 }
 
+// historyTexts returns texts of the history entries.
+func historyTexts(entries []HistoryEntry) []string {
+	texts := make([]string, len(entries))
+	for i, entry := range entries {
+		texts[i] = entry.Text
+	}
+	return texts
+}
+
 // NewHistory returns new history object.
 func NewHistory() *History {
 	return &History{
-		histories: []string{},
+		histories: []HistoryEntry{},
 		tmp:       []string{""},
 		selected:  0,
+		executing: -1,
 	}
 }
@@ -0,0 +1,311 @@
+package prompt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExpandHistory performs bash-like history expansion of the line using
+// the history commands from the oldest to the newest. It supports:
+//
+//   - event designators: !!, !n, !-n, !string, !?string[?];
+//   - word designators after an event or alone: !$, !^, !*, !:n, !:x-y,
+//     !:x-, !:x*, !!:$ and so on;
+//   - quick substitution at the beginning of the line: ^old^new^.
+//
+// Like in bash, '!' is not expanded inside single quotes, after a backslash
+// and before a blank, '=' or '('. The returned error describes the designator,
+// which cannot be expanded.
+func ExpandHistory(line string, history []string) (string, error) {
+	e := historyExpander{line: []rune(line), history: history}
+	return e.expand()
+}
+
+// historyExpander contains the state of the history expansion.
+type historyExpander struct {
+	line    []rune
+	pos     int
+	history []string
+}
+
+// expand returns the expanded line.
+func (e *historyExpander) expand() (string, error) {
+	sb := strings.Builder{}
+	if len(e.line) > 0 && e.line[0] == '^' {
+		substituted, err := e.quickSubstitution()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(substituted)
+	}
+
+	inSingleQuotes, inDoubleQuotes := false, false
+	for e.pos < len(e.line) {
+		r := e.line[e.pos]
+		switch {
+		case r == '\\' && !inSingleQuotes:
+			sb.WriteRune(r)
+			e.pos++
+			if e.pos < len(e.line) {
+				sb.WriteRune(e.line[e.pos])
+				e.pos++
+			}
+			continue
+		case r == '\'' && !inDoubleQuotes:
+			inSingleQuotes = !inSingleQuotes
+		case r == '"' && !inSingleQuotes:
+			inDoubleQuotes = !inDoubleQuotes
+		case r == '!' && !inSingleQuotes && e.isDesignator(inDoubleQuotes):
+			expanded, err := e.event()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(expanded)
+			continue
+		}
+		sb.WriteRune(r)
+		e.pos++
+	}
+	return sb.String(), nil
+}
+
+// isDesignator returns true if '!' at the current position starts a designator.
+func (e *historyExpander) isDesignator(inDoubleQuotes bool) bool {
+	if e.pos+1 >= len(e.line) {
+		return false
+	}
+	next := e.line[e.pos+1]
+	return !unicode.IsSpace(next) && next != '=' && next != '(' &&
+		!(inDoubleQuotes && next == '"')
+}
+
+// event expands the event designator at the current position with
+// the following word designator.
+func (e *historyExpander) event() (string, error) {
+	start := e.pos
+	e.pos++
+
+	cmd, found := "", false
+	direct := true // Word designators may follow without ':'.
+	switch r := e.line[e.pos]; {
+	case r == '!':
+		e.pos++
+		cmd, found = e.relative(1)
+	case r == '-' && e.pos+1 < len(e.line) && isDigitRune(e.line[e.pos+1]):
+		e.pos++
+		cmd, found = e.relative(e.number())
+	case isDigitRune(r):
+		n := e.number()
+		if n >= 1 && n <= len(e.history) {
+			cmd, found = e.history[n-1], true
+		}
+	case r == '?':
+		e.pos++
+		sub := e.readUntil(func(r rune) bool { return r == '?' || r == '\n' })
+		if e.pos < len(e.line) && e.line[e.pos] == '?' {
+			e.pos++
+		}
+		cmd, found = e.search(func(cmd string) bool { return strings.Contains(cmd, sub) })
+	case strings.ContainsRune("^$*:", r):
+		// The word designator of the previous command.
+		cmd, found = e.relative(1)
+	default:
+		prefix := e.readUntil(func(r rune) bool {
+			return unicode.IsSpace(r) || strings.ContainsRune(":'\"", r)
+		})
+		cmd, found = e.search(func(cmd string) bool { return strings.HasPrefix(cmd, prefix) })
+		direct = false
+	}
+	if !found {
+		return "", fmt.Errorf("%s: event not found", string(e.line[start:e.pos]))
+	}
+	return e.words(cmd, start, direct)
+}
+
+// words expands the word designator at the current position for
+// the command of the event started at start. If direct is true,
+// the word designator may start without ':'.
+func (e *historyExpander) words(cmd string, start int, direct bool) (string, error) {
+	if e.pos >= len(e.line) {
+		return cmd, nil
+	}
+	switch r := e.line[e.pos]; {
+	case r == ':':
+		e.pos++
+	case direct && strings.ContainsRune("^$*", r):
+	case direct && r == '-' && e.pos+1 < len(e.line) && isDigitRune(e.line[e.pos+1]):
+	default:
+		return cmd, nil
+	}
+
+	words := splitHistoryWords(cmd)
+	last := len(words) - 1
+	badSpecifier := func() error {
+		return fmt.Errorf("%s: bad word specifier", string(e.line[start:e.pos]))
+	}
+
+	from, to := 0, -1
+	switch r := e.peek(); {
+	case r == '*':
+		e.pos++
+		if last < 1 {
+			return "", nil
+		}
+		return strings.Join(words[1:], " "), nil
+	case r == '^':
+		e.pos++
+		from = 1
+	case r == '$':
+		e.pos++
+		from = last
+	case isDigitRune(r):
+		from = e.number()
+	case r == '-':
+		from = 0
+	default:
+		if unicode.IsLetter(r) {
+			e.pos++
+			return "", fmt.Errorf("%s: unrecognized history modifier", string(e.line[start:e.pos]))
+		}
+		return "", badSpecifier()
+	}
+
+	switch e.peek() {
+	case '-':
+		e.pos++
+		switch r := e.peek(); {
+		case r == '$':
+			e.pos++
+			to = last
+		case isDigitRune(r):
+			to = e.number()
+		default:
+			// "x-" abbreviates "x-$", but omits the last word.
+			to = last - 1
+		}
+	case '*':
+		e.pos++
+		to = last
+	default:
+		to = from
+	}
+
+	if from < 0 || from > last || to > last || from > to {
+		return "", badSpecifier()
+	}
+	return strings.Join(words[from:to+1], " "), nil
+}
+
+// quickSubstitution expands "^old^new^" at the beginning of the line:
+// the first occurrence of old is replaced with new in the previous command.
+func (e *historyExpander) quickSubstitution() (string, error) {
+	e.pos = 1
+	isCaret := func(r rune) bool { return r == '^' }
+	old := e.readUntil(isCaret)
+	new := ""
+	if e.peek() == '^' {
+		e.pos++
+		new = e.readUntil(isCaret)
+		if e.peek() == '^' {
+			e.pos++
+		}
+	}
+
+	cmd, found := e.relative(1)
+	if !found {
+		return "", fmt.Errorf("%s: event not found", string(e.line[:e.pos]))
+	}
+	if old == "" || !strings.Contains(cmd, old) {
+		return "", fmt.Errorf("%s: substitution failed", string(e.line[:e.pos]))
+	}
+	return strings.Replace(cmd, old, new, 1), nil
+}
+
+// relative returns the n-th command from the end of the history.
+func (e *historyExpander) relative(n int) (cmd string, found bool) {
+	if n < 1 || n > len(e.history) {
+		return "", false
+	}
+	return e.history[len(e.history)-n], true
+}
+
+// search returns the most recent command matched by match.
+func (e *historyExpander) search(match func(cmd string) bool) (cmd string, found bool) {
+	for i := len(e.history) - 1; i >= 0; i-- {
+		if match(e.history[i]) {
+			return e.history[i], true
+		}
+	}
+	return "", false
+}
+
+// peek returns the rune at the current position, 0 at the end of the line.
+func (e *historyExpander) peek() rune {
+	if e.pos >= len(e.line) {
+		return 0
+	}
+	return e.line[e.pos]
+}
+
+// number reads a decimal number at the current position.
+func (e *historyExpander) number() int {
+	digits := e.readUntil(func(r rune) bool { return !isDigitRune(r) })
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// readUntil reads runes from the current position until stop returns true.
+func (e *historyExpander) readUntil(stop func(r rune) bool) string {
+	start := e.pos
+	for e.pos < len(e.line) && !stop(e.line[e.pos]) {
+		e.pos++
+	}
+	return string(e.line[start:e.pos])
+}
+
+// isDigitRune returns true if r is an ASCII digit.
+func isDigitRune(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// splitHistoryWords splits the command into words separated by blanks.
+// Quoted strings and escaped blanks do not separate words.
+func splitHistoryWords(cmd string) []string {
+	words := []string{}
+	word := strings.Builder{}
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		}
+		word.WriteRune(r)
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
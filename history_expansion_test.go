@@ -0,0 +1,85 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandHistory(t *testing.T) {
+	history := []string{
+		"box.cfg{listen = 3301}",
+		`echo "a b" c\ d e`,
+		"select * from t where id = 1",
+		"git commit -m 'fix typo'",
+	}
+
+	cases := []struct {
+		line     string
+		expected string
+		err      string
+	}{
+		{line: "", expected: ""},
+		{line: "no expansion", expected: "no expansion"},
+		{line: "!!", expected: "git commit -m 'fix typo'"},
+		{line: "sudo !! now", expected: "sudo git commit -m 'fix typo' now"},
+		{line: "!1", expected: "box.cfg{listen = 3301}"},
+		{line: "!-2", expected: "select * from t where id = 1"},
+		{line: "!box", expected: "box.cfg{listen = 3301}"},
+		{line: "!?from?", expected: "select * from t where id = 1"},
+		{line: "!?listen", expected: "box.cfg{listen = 3301}"},
+		{line: "x !$", expected: "x 'fix typo'"},
+		{line: "!^", expected: "commit"},
+		{line: "!*", expected: "commit -m 'fix typo'"},
+		{line: "!:2", expected: "-m"},
+		{line: "!!:0", expected: "git"},
+		{line: "!2:1-2", expected: `"a b" c\ d`},
+		{line: "!2:1-", expected: `"a b" c\ d`},
+		{line: "!2:2*", expected: `c\ d e`},
+		{line: "!2:-1", expected: `echo "a b"`},
+		{line: "!2$", expected: "e"},
+		{line: "!e:$", expected: "e"},
+		{line: "!1:*", expected: "= 3301}"},
+		{line: "^typo^bug", expected: "git commit -m 'fix bug'"},
+		{line: "^typo^bug^ --amend !!:0", expected: "git commit -m 'fix bug' --amend git"},
+		{line: "^ typo", expected: "git commit -m 'fix'"},
+		{line: "a != b", expected: "a != b"},
+		{line: "!", expected: "!"},
+		{line: "f(!(x))", expected: "f(!(x))"},
+		{line: "x = !y", err: "!y: event not found"},
+		{line: `'!!' "!!" \!!`, expected: `'!!' "git commit -m 'fix typo'" \!!`},
+		{line: `"!"`, expected: `"!"`},
+		{line: "!10", err: "!10: event not found"},
+		{line: "!-5", err: "!-5: event not found"},
+		{line: "!?nothing?", err: "!?nothing?: event not found"},
+		{line: "!!:9", err: "!!:9: bad word specifier"},
+		{line: "!!:3-1", err: "!!:3-1: bad word specifier"},
+		{line: "!!:h", err: "!!:h: unrecognized history modifier"},
+		{line: "^nothing^x", err: "^nothing^x: substitution failed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.line, func(t *testing.T) {
+			expanded, err := ExpandHistory(tc.line, history)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, expanded)
+		})
+	}
+
+	t.Run("empty history", func(t *testing.T) {
+		_, err := ExpandHistory("!!", nil)
+		assert.EqualError(t, err, "!!: event not found")
+		_, err = ExpandHistory("^a^b", nil)
+		assert.EqualError(t, err, "^a^b: event not found")
+	})
+}
+
+func TestSplitHistoryWords(t *testing.T) {
+	assert.Equal(t, []string{}, splitHistoryWords("  "))
+	assert.Equal(t, []string{"a", `"b c"`, `d\ e`, `'f "g'`, "h"},
+		splitHistoryWords(` a  "b c" d\ e 'f "g' h `))
+}
@@ -0,0 +1,140 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// historyPickerPrefixFmt is the format of the prefix in the history picker mode.
+const historyPickerPrefixFmt = "(history)`%s':"
+
+// historyPicker contains the state of the history picker popup.
+type historyPicker struct {
+	// entries are the unique history entries from the newest to the oldest.
+	entries []HistoryEntry
+	// query is the current fuzzy query.
+	query string
+	// matched contains indexes of the entries matched by the query.
+	matched []int
+	// completion renders the matched entries as a dropdown.
+	completion *CompletionManager
+	// originalBuf is the buffer before the picker was opened.
+	originalBuf *Buffer
+	// now returns the current time to format relative timestamps.
+	now func() time.Time
+}
+
+// newHistoryPicker returns a picker over the history entries,
+// which shows at most max entries at once.
+func newHistoryPicker(histories []HistoryEntry, max uint16) *historyPicker {
+	hp := &historyPicker{
+		entries: make([]HistoryEntry, 0, len(histories)),
+		now:     time.Now,
+	}
+	seen := make(map[string]struct{}, len(histories))
+	for i := len(histories) - 1; i >= 0; i-- {
+		text := histories[i].Text
+		if _, ok := seen[text]; ok || strings.TrimSpace(text) == "" {
+			continue
+		}
+		seen[text] = struct{}{}
+		hp.entries = append(hp.entries, histories[i])
+	}
+	hp.completion = NewCompletionManager(func(Document) []Suggest {
+		return hp.completion.tmp
+	}, max)
+	hp.filter()
+	return hp
+}
+
+// update sets the query and filters the entries, if the query is changed.
+func (hp *historyPicker) update(query string) {
+	if query != hp.query {
+		hp.query = query
+		hp.filter()
+	}
+}
+
+// filter filters the entries by the fuzzy query and selects the first match.
+// The query is case-insensitive if it has no upper case letters, spaces in it
+// are ignored.
+func (hp *historyPicker) filter() {
+	query := strings.Join(strings.Fields(hp.query), "")
+	ignoreCase := query == strings.ToLower(query)
+
+	now := hp.now()
+	hp.matched = hp.matched[:0]
+	suggests := make([]Suggest, 0, len(hp.entries))
+	matches := make([][]int, 0, len(hp.entries))
+	for i, entry := range hp.entries {
+		text := historyPickerText(entry.Text)
+		positions, ok := fuzzyMatchPositions(text, query, ignoreCase)
+		if !ok {
+			continue
+		}
+		hp.matched = append(hp.matched, i)
+		suggests = append(suggests, Suggest{
+			Text:        text,
+			Description: formatRelativeTime(entry.Time, now),
+		})
+		matches = append(matches, positions)
+	}
+
+	hp.completion.tmp = suggests
+	hp.completion.matches = matches
+	hp.completion.verticalScroll = 0
+	hp.completion.selected = -1
+	if len(suggests) > 0 {
+		hp.completion.selected = 0
+	}
+}
+
+// next selects the next (older) matched entry.
+func (hp *historyPicker) next() {
+	if hp.completion.selected < len(hp.matched)-1 {
+		hp.completion.Next()
+	}
+}
+
+// previous selects the previous (newer) matched entry.
+func (hp *historyPicker) previous() {
+	if hp.completion.selected > 0 {
+		hp.completion.Previous()
+	}
+}
+
+// selected returns the selected entry, ok is false if nothing is matched.
+func (hp *historyPicker) selected() (entry HistoryEntry, ok bool) {
+	if hp.completion.selected < 0 || hp.completion.selected >= len(hp.matched) {
+		return HistoryEntry{}, false
+	}
+	return hp.entries[hp.matched[hp.completion.selected]], true
+}
+
+// historyPickerText returns the entry text to show in a single line
+// keeping its runes count.
+func historyPickerText(text string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(text)
+}
+
+// formatRelativeTime formats the time relatively to now like "5m ago",
+// the zero time is formatted as an empty string.
+func formatRelativeTime(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	default:
+		return fmt.Sprintf("%dy ago", int(d/(365*24*time.Hour)))
+	}
+}
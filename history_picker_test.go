@@ -0,0 +1,78 @@
+package prompt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryPicker(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	histories := []HistoryEntry{
+		{Text: "box.info", Time: now.Add(-48 * time.Hour)},
+		{Text: "print(1)", Time: now.Add(-2 * time.Hour)},
+		{Text: " "},
+		{Text: "if a then\n    b()\nend"},
+		{Text: "box.info", Time: now.Add(-5 * time.Minute)},
+	}
+
+	hp := newHistoryPicker(histories, 2)
+	hp.now = func() time.Time { return now }
+	hp.filter()
+
+	// Newest first, deduplicated, blank entries are skipped.
+	assert.Equal(t, []Suggest{
+		{Text: "box.info", Description: "5m ago"},
+		{Text: "if a then     b() end"},
+		{Text: "print(1)", Description: "2h ago"},
+	}, hp.completion.GetSuggestions())
+	entry, ok := hp.selected()
+	assert.True(t, ok)
+	assert.Equal(t, histories[4], entry)
+
+	// Navigation stops at the bounds.
+	hp.previous()
+	assert.Equal(t, 0, hp.completion.selected)
+	for i := 0; i < 5; i++ {
+		hp.next()
+	}
+	assert.Equal(t, 2, hp.completion.selected)
+	assert.Equal(t, 1, hp.completion.verticalScroll)
+	entry, _ = hp.selected()
+	assert.Equal(t, "print(1)", entry.Text)
+
+	// The query resets the selection.
+	hp.update("b( ")
+	assert.Equal(t, []Suggest{{Text: "if a then     b() end"}}, hp.completion.GetSuggestions())
+	assert.Equal(t, [][]int{{14, 15}}, hp.completion.matches)
+	assert.Equal(t, 0, hp.completion.selected)
+	// Upper case letters make the query case-sensitive.
+	hp.update("B(")
+	assert.Equal(t, 0, len(hp.completion.GetSuggestions()))
+
+	hp.update("xyz")
+	_, ok = hp.selected()
+	assert.False(t, ok)
+}
+
+func TestFormatRelativeTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		ago      time.Duration
+		expected string
+	}{
+		{ago: 10 * time.Second, expected: "just now"},
+		{ago: 59 * time.Minute, expected: "59m ago"},
+		{ago: 3 * time.Hour, expected: "3h ago"},
+		{ago: 30 * 24 * time.Hour, expected: "30d ago"},
+		{ago: 800 * 24 * time.Hour, expected: "2y ago"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, formatRelativeTime(now.Add(-tc.ago), now))
+		})
+	}
+	assert.Equal(t, "", formatRelativeTime(time.Time{}, now))
+}
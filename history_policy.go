@@ -0,0 +1,73 @@
+package prompt
+
+import "strings"
+
+// HistoryPolicy defines which entries are kept in the history.
+type HistoryPolicy struct {
+	// IgnoreDups rejects an entry equal to the previous one.
+	IgnoreDups bool
+	// EraseDups removes all previous occurrences of an entry before adding it.
+	EraseDups bool
+	// IgnoreSpace rejects entries starting with a space.
+	IgnoreSpace bool
+	// Filter rejects an entry if it returns false. It may be used to keep
+	// sensitive input, like passwords, out of the history.
+	Filter func(entry string) bool
+	// MaxSize is the maximum number of entries, the oldest entries are
+	// evicted on overflow. Zero means no limit.
+	MaxSize int
+}
+
+// accepts returns true if the entry is not rejected by the policy filters.
+func (p *HistoryPolicy) accepts(entry string) bool {
+	if p.IgnoreSpace && strings.HasPrefix(entry, " ") {
+		return false
+	}
+	return p.Filter == nil || p.Filter(entry)
+}
+
+// push appends an entry to the history entries according to the policy.
+// Returns false if the entry was rejected.
+// The history state must be cleared after that.
+func (h *History) push(entry HistoryEntry) bool {
+	if !h.policy.accepts(entry.Text) {
+		return false
+	}
+	if n := len(h.histories); h.policy.IgnoreDups && n > 0 && h.histories[n-1].Text == entry.Text {
+		return false
+	}
+	if h.policy.EraseDups {
+		h.erase(entry.Text)
+	}
+	h.histories = append(h.histories, entry)
+	h.evict()
+	return true
+}
+
+// erase removes all entries with the text.
+func (h *History) erase(text string) {
+	kept := make([]HistoryEntry, 0, len(h.histories))
+	sessionStart := h.sessionStart
+	for i, e := range h.histories {
+		if e.Text != text {
+			kept = append(kept, e)
+		} else if i < h.sessionStart {
+			sessionStart--
+		}
+	}
+	h.histories = kept
+	h.sessionStart = sessionStart
+}
+
+// evict removes the oldest entries exceeding the maximum size.
+func (h *History) evict() {
+	n := len(h.histories) - h.policy.MaxSize
+	if h.policy.MaxSize <= 0 || n <= 0 {
+		return
+	}
+	h.histories = append([]HistoryEntry{}, h.histories[n:]...)
+	h.sessionStart -= n
+	if h.sessionStart < 0 {
+		h.sessionStart = 0
+	}
+}
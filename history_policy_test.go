@@ -0,0 +1,105 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryPolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   HistoryPolicy
+		expected []string
+	}{
+		{
+			name:     "default",
+			policy:   HistoryPolicy{},
+			expected: []string{"a", "b", "b", " c", "a", "secret 1", "d"},
+		},
+		{
+			name:     "ignore dups",
+			policy:   HistoryPolicy{IgnoreDups: true},
+			expected: []string{"a", "b", " c", "a", "secret 1", "d"},
+		},
+		{
+			name:     "erase dups",
+			policy:   HistoryPolicy{EraseDups: true},
+			expected: []string{"b", " c", "a", "secret 1", "d"},
+		},
+		{
+			name:     "ignore space",
+			policy:   HistoryPolicy{IgnoreSpace: true},
+			expected: []string{"a", "b", "b", "a", "secret 1", "d"},
+		},
+		{
+			name: "filter",
+			policy: HistoryPolicy{Filter: func(entry string) bool {
+				return !strings.Contains(entry, "secret")
+			}},
+			expected: []string{"a", "b", "b", " c", "a", "d"},
+		},
+		{
+			name:     "max size",
+			policy:   HistoryPolicy{MaxSize: 3},
+			expected: []string{"a", "secret 1", "d"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHistory()
+			h.policy = tc.policy
+			for _, entry := range []string{"a", "b", "b", " c", "a", "secret 1", "d"} {
+				h.Add(entry)
+			}
+			assert.Equal(t, tc.expected, historyTexts(h.histories))
+			assert.Equal(t, len(tc.expected), h.selected)
+		})
+	}
+}
+
+func TestHistoryPolicyLoad(t *testing.T) {
+	store := &sharedHistoryStoreStub{entries: textHistoryEntries("a", "b", "a", "c", "d")}
+	h := NewHistory()
+	h.Add("d")
+	h.store = store
+	h.policy = HistoryPolicy{EraseDups: true, MaxSize: 3}
+	assert.NoError(t, h.load())
+	assert.Equal(t, []string{"a", "c", "d"}, historyTexts(h.histories))
+	assert.Equal(t, 3, h.sessionStart)
+	assert.Equal(t, 5, h.storeSize)
+
+	h.Add("e")
+	assert.Equal(t, []string{"c", "d", "e"}, historyTexts(h.histories))
+	assert.Equal(t, 2, h.sessionStart)
+	assert.Equal(t, 6, h.storeSize)
+	assert.Equal(t, 6, len(store.entries))
+
+	// The store is compacted when it is twice as large as the history.
+	h.Add("f")
+	assert.Equal(t, []string{"d", "e", "f"}, historyTexts(h.histories))
+	assert.Equal(t, 3, h.storeSize)
+	assert.Equal(t, []string{"d", "e", "f"}, historyTexts(store.entries))
+}
+
+func TestPushToHistoryPolicy(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{} },
+		OptionDisableAutoHistory(),
+		OptionHistoryPolicy(HistoryPolicy{IgnoreSpace: true}),
+	)
+	assert.NoError(t, prompt.PushToHistory(" password"))
+	assert.NoError(t, prompt.PushToHistory("cmd"))
+	assert.Equal(t, []string{"cmd"}, historyTexts(prompt.history.histories))
+}
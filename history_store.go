@@ -0,0 +1,504 @@
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tarantool/go-prompt/internal/debug"
+)
+
+// HistoryStore is a persistent storage of the history.
+type HistoryStore interface {
+	// Load returns all stored entries from the oldest to the newest.
+	Load() ([]HistoryEntry, error)
+	// Append stores a new entry after the existing ones.
+	Append(entry HistoryEntry) error
+	// Compact replaces the stored entries with the passed ones.
+	// The history compacts the store automatically, when it becomes twice
+	// as large as the history.
+	Compact(entries []HistoryEntry) error
+}
+
+// SharedHistoryStore is a HistoryStore, which may be appended by several
+// sessions at the same time. Its Compact must keep entries appended by other
+// sessions, which are not returned by LoadNew yet, so the compaction does not
+// erase the commands of other sessions.
+type SharedHistoryStore interface {
+	HistoryStore
+	// LoadNew returns entries appended by other sessions since the previous
+	// call of LoadNew or Load.
+	LoadNew() ([]HistoryEntry, error)
+}
+
+// UpdatableHistoryStore is a HistoryStore, which can store the execution
+// results of an already appended entry.
+type UpdatableHistoryStore interface {
+	HistoryStore
+	// Update stores the Duration and the Status of the entry appended before.
+	// The entry is found by its Text and Time.
+	Update(entry HistoryEntry) error
+}
+
+// FileHistoryStore is a SharedHistoryStore and an UpdatableHistoryStore,
+// which keeps entries in a text file. Every entry text is written as a single
+// line, so line breaks and backslashes inside it are escaped. The entry
+// metadata is written as a JSON object on the preceding line starting with
+// "#{". The execution results of an entry are written later as a JSON object
+// on a line starting with "#+{". Other lines starting with '#' are comments
+// and are skipped on loading.
+//
+// Access to the file is serialized between processes with an advisory lock
+// on a separate file with the ".lock" suffix.
+type FileHistoryStore struct {
+	path string
+
+	// info describes the history file, as it was seen last time.
+	// It is used to detect the file replacement on compaction.
+	info os.FileInfo
+	// offset is the size of the already read part of the history file.
+	offset int64
+	// pending contains entries of other sessions, which were read
+	// on appending and not returned by LoadNew yet.
+	pending []HistoryEntry
+	// known contains the keys of the entries in the history file, which
+	// are known to the session. They are skipped when the file replaced
+	// by another session is read again.
+	known map[historyEntryKey]struct{}
+}
+
+// historyEntryKey identifies an entry in the history file.
+type historyEntryKey struct {
+	text string
+	// time is the stored time of the entry.
+	time int64
+}
+
+// remember adds the entries to the known ones.
+func (s *FileHistoryStore) remember(entries []HistoryEntry) {
+	if s.known == nil {
+		s.known = make(map[historyEntryKey]struct{})
+	}
+	for _, entry := range entries {
+		s.known[historyEntryKey{entry.Text, historyEntryTime(entry)}] = struct{}{}
+	}
+}
+
+// unknown returns the entries, which are not known to the session.
+func (s *FileHistoryStore) unknown(entries []HistoryEntry) []HistoryEntry {
+	result := []HistoryEntry{}
+	for _, entry := range entries {
+		if _, ok := s.known[historyEntryKey{entry.Text, historyEntryTime(entry)}]; !ok {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// NewFileHistoryStore returns a new FileHistoryStore for the file at path.
+// The file is created on the first append if it does not exist.
+func NewFileHistoryStore(path string) *FileHistoryStore {
+	return &FileHistoryStore{path: path}
+}
+
+// Load reads all entries from the file. A missing file is an empty history.
+func (s *FileHistoryStore) Load() ([]HistoryEntry, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	s.info, s.offset, s.pending, s.known = nil, 0, nil, nil
+	return s.readNew(true)
+}
+
+// LoadNew reads entries appended to the file by other sessions.
+// If the file was compacted by another session, it is read again and
+// the entries, which are not known yet, are returned.
+func (s *FileHistoryStore) LoadNew() ([]HistoryEntry, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := s.readNew(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.pending) > 0 {
+		entries = append(s.pending, entries...)
+		s.pending = nil
+	}
+	return entries, nil
+}
+
+// Append appends an entry to the end of the file.
+func (s *FileHistoryStore) Append(entry HistoryEntry) error {
+	if err := s.write(formatHistoryEntry(entry)); err != nil {
+		return err
+	}
+	s.remember([]HistoryEntry{entry})
+	return nil
+}
+
+// Update appends the execution results of the entry to the end of the file.
+func (s *FileHistoryStore) Update(entry HistoryEntry) error {
+	return s.write(formatHistoryEntryResult(entry))
+}
+
+// write appends the lines to the end of the file.
+func (s *FileHistoryStore) write(lines string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Remember entries of other sessions to not skip them in LoadNew.
+	entries, err := s.readNew(true)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, entries...)
+
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Terminate the last line, so the lines are not joined.
+	if s.info, err = f.Stat(); err != nil {
+		return err
+	}
+	if size := s.info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err = f.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			lines = "\n" + lines
+		}
+	}
+	if _, err = f.WriteString(lines); err != nil {
+		return err
+	}
+	if s.info, err = f.Stat(); err != nil {
+		return err
+	}
+	s.offset = s.info.Size()
+	return f.Close()
+}
+
+// Compact atomically rewrites the file with the passed entries. Entries of
+// other sessions, which are not returned by LoadNew yet, are kept after
+// them and are still returned by the next LoadNew.
+func (s *FileHistoryStore) Compact(entries []HistoryEntry) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	unread, err := s.readNew(true)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, unread...)
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	w := bufio.NewWriter(f)
+	for _, list := range [][]HistoryEntry{entries, s.pending} {
+		for _, entry := range list {
+			if _, err = w.WriteString(formatHistoryEntry(entry)); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.info, err = os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.offset = s.info.Size()
+	s.known = nil
+	s.remember(entries)
+	s.remember(s.pending)
+	return nil
+}
+
+// lock acquires the lock of the history file and returns
+// a function to release it. The lock file is created only for the exclusive
+// lock, there are no writers to wait for if it does not exist.
+func (s *FileHistoryStore) lock(exclusive bool) (unlock func(), err error) {
+	var f *os.File
+	if exclusive {
+		f, err = os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	} else {
+		f, err = os.Open(s.path + ".lock")
+		if os.IsNotExist(err) {
+			return func() {}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// readNew reads lines written after the last known offset. An unterminated
+// last line is read only if eof is true, otherwise it is left to the next
+// read, because it may be still written. The lock must be acquired.
+func (s *FileHistoryStore) readNew(eof bool) ([]HistoryEntry, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.info, s.offset = nil, 0
+			return []HistoryEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	replaced := s.info != nil && (!os.SameFile(s.info, info) || info.Size() < s.offset)
+	if replaced {
+		// The file was compacted by another session, it is read again.
+		s.offset = 0
+	}
+	s.info = info
+
+	if _, err = f.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if !eof {
+		// Leave an incomplete line to the next read.
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	}
+	s.offset += int64(len(data))
+	entries, results, err := readHistoryEntries(bytes.NewReader(data))
+	// The results of the entries read before are known only for the pending ones.
+	for _, result := range results {
+		result.apply(s.pending)
+	}
+	if replaced {
+		entries = s.unknown(entries)
+	}
+	s.remember(entries)
+	return entries, err
+}
+
+// historyEntryMeta is the stored metadata of a history entry.
+type historyEntryMeta struct {
+	// Time is the Unix time in milliseconds.
+	Time int64 `json:"time,omitempty"`
+	// Duration is the duration in milliseconds.
+	Duration int64  `json:"duration,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Dir      string `json:"dir,omitempty"`
+}
+
+// historyEntryResult is the stored execution result of an entry.
+type historyEntryResult struct {
+	Text string `json:"text"`
+	// Time is the Unix time of the entry in milliseconds.
+	Time int64 `json:"time,omitempty"`
+	// Duration is the duration in milliseconds.
+	Duration int64  `json:"duration,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// apply sets the result to the newest entry with the same text and time.
+// It returns false if there is no such entry.
+func (r historyEntryResult) apply(entries []HistoryEntry) bool {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Text == r.Text && historyEntryTime(entries[i]) == r.Time {
+			entries[i].Duration = time.Duration(r.Duration) * time.Millisecond
+			entries[i].Status = r.Status
+			return true
+		}
+	}
+	return false
+}
+
+// historyEntryTime returns the stored time of the entry.
+func historyEntryTime(entry HistoryEntry) int64 {
+	if entry.Time.IsZero() {
+		return 0
+	}
+	return entry.Time.UnixNano() / int64(time.Millisecond)
+}
+
+// formatHistoryEntryResult returns the line of the stored execution result
+// of the entry.
+func formatHistoryEntryResult(entry HistoryEntry) string {
+	data, err := json.Marshal(historyEntryResult{
+		Text:     entry.Text,
+		Time:     historyEntryTime(entry),
+		Duration: int64(entry.Duration / time.Millisecond),
+		Status:   entry.Status,
+	})
+	if err != nil {
+		return ""
+	}
+	return "#+" + string(data) + "\n"
+}
+
+// formatHistoryEntry returns lines of the stored entry with its metadata.
+func formatHistoryEntry(entry HistoryEntry) string {
+	meta := historyEntryMeta{
+		Time:     historyEntryTime(entry),
+		Duration: int64(entry.Duration / time.Millisecond),
+		Status:   entry.Status,
+		Dir:      entry.Dir,
+	}
+
+	line := encodeHistoryEntry(entry.Text) + "\n"
+	if meta == (historyEntryMeta{}) {
+		return line
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return line
+	}
+	return "#" + string(data) + "\n" + line
+}
+
+// readHistoryEntries decodes entries from the reader line by line.
+// The execution results are applied to the read entries, the results
+// of other entries are returned.
+func readHistoryEntries(r io.Reader) (
+	entries []HistoryEntry, results []historyEntryResult, err error) {
+	entries = []HistoryEntry{}
+	var meta historyEntryMeta
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "#+{") {
+			var result historyEntryResult
+			if err := json.Unmarshal([]byte(line[2:]), &result); err != nil {
+				debug.Log("history: cannot decode the entry result: " + err.Error())
+			} else if !result.apply(entries) {
+				results = append(results, result)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#{") {
+			meta = historyEntryMeta{}
+			if err := json.Unmarshal([]byte(line[1:]), &meta); err != nil {
+				debug.Log("history: cannot decode the entry metadata: " + err.Error())
+			}
+			continue
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		entry := HistoryEntry{
+			Text:     decodeHistoryEntry(line),
+			Duration: time.Duration(meta.Duration) * time.Millisecond,
+			Status:   meta.Status,
+			Dir:      meta.Dir,
+		}
+		if meta.Time != 0 {
+			entry.Time = time.Unix(0, meta.Time*int64(time.Millisecond))
+		}
+		entries = append(entries, entry)
+		meta = historyEntryMeta{}
+	}
+	return entries, results, scanner.Err()
+}
+
+// encodeHistoryEntry escapes an entry text to be stored as a single line.
+func encodeHistoryEntry(text string) string {
+	sb := strings.Builder{}
+	sb.Grow(len(text))
+	for i, r := range text {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '#' && i == 0:
+			sb.WriteString(`\#`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// decodeHistoryEntry restores an entry text escaped by encodeHistoryEntry.
+func decodeHistoryEntry(line string) string {
+	sb := strings.Builder{}
+	sb.Grow(len(line))
+	escaped := false
+	for _, r := range line {
+		if !escaped {
+			if r == '\\' {
+				escaped = true
+			} else {
+				sb.WriteRune(r)
+			}
+			continue
+		}
+		escaped = false
+		switch r {
+		case 'n':
+			sb.WriteRune('\n')
+		case 'r':
+			sb.WriteRune('\r')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if escaped {
+		sb.WriteRune('\\')
+	}
+	return sb.String()
+}
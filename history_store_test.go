@@ -0,0 +1,440 @@
+package prompt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryEntryEncoding(t *testing.T) {
+	cases := []struct {
+		entry   string
+		encoded string
+	}{
+		{entry: "", encoded: ""},
+		{entry: "box.info()", encoded: "box.info()"},
+		{entry: "if a then\n    b()\nend", encoded: `if a then\n    b()\nend`},
+		{entry: `print("\n")`, encoded: `print("\\n")`},
+		{entry: "a\r\nb", encoded: `a\r\nb`},
+		{entry: "#comment", encoded: `\#comment`},
+		{entry: "a # b", encoded: "a # b"},
+		{entry: "строка\nещё", encoded: `строка\nещё`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.encoded, func(t *testing.T) {
+			assert.Equal(t, tc.encoded, encodeHistoryEntry(tc.entry))
+			assert.Equal(t, tc.entry, decodeHistoryEntry(tc.encoded))
+		})
+	}
+}
+
+func TestFileHistoryStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileHistoryStore(filepath.Join(dir, "history"))
+
+	t.Run("missing file", func(t *testing.T) {
+		entries, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, historyTexts(entries))
+	})
+
+	entries := textHistoryEntries("cmd1", "if a then\n    b()\nend", `"\n"`, "#not a comment")
+	entries[0].Time = time.Unix(1700000000, 123000000)
+	entries[0].Duration = 1500 * time.Millisecond
+	entries[0].Status = "error"
+	entries[0].Dir = "/home/user"
+	entries[2].Time = time.Unix(1700000001, 0)
+
+	t.Run("append", func(t *testing.T) {
+		for _, entry := range entries {
+			require.NoError(t, store.Append(entry))
+		}
+		loaded, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, entries, loaded)
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		require.NoError(t, store.Compact(entries[1:3]))
+		loaded, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, entries[1:3], loaded)
+
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Equal(t, 2, len(files))
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		content := "# comment\r\ncmd1\r\n\r\n#{\"status\":\"ok\"}\n#{broken\ncmd2\n"
+		require.NoError(t, ioutil.WriteFile(store.path, []byte(content), 0600))
+		loaded, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"cmd1", "cmd2"}, historyTexts(loaded))
+	})
+}
+
+func TestFormatHistoryEntry(t *testing.T) {
+	cases := []struct {
+		entry    HistoryEntry
+		expected string
+	}{
+		{
+			entry:    HistoryEntry{Text: "a\nb"},
+			expected: "a\\nb\n",
+		},
+		{
+			entry: HistoryEntry{
+				Text:     "cmd",
+				Time:     time.Unix(1700000000, 0),
+				Duration: 2 * time.Second,
+				Status:   "ok",
+				Dir:      "/tmp",
+			},
+			expected: `#{"time":1700000000000,"duration":2000,"status":"ok","dir":"/tmp"}` +
+				"\ncmd\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, formatHistoryEntry(tc.entry))
+		})
+	}
+}
+
+func TestFileHistoryStoreShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	first := NewFileHistoryStore(path)
+	second := NewFileHistoryStore(path)
+	for _, store := range []*FileHistoryStore{first, second} {
+		_, err := store.Load()
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, first.Append(HistoryEntry{Text: "first 1"}))
+	require.NoError(t, second.Append(HistoryEntry{Text: "second 1"}))
+	require.NoError(t, first.Append(HistoryEntry{Text: "first 2"}))
+
+	entries, err := first.LoadNew()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"second 1"}, historyTexts(entries))
+	entries, err = first.LoadNew()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, historyTexts(entries))
+
+	entries, err = second.LoadNew()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first 1", "first 2"}, historyTexts(entries))
+
+	t.Run("incomplete line", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		require.NoError(t, err)
+		defer f.Close()
+
+		_, err = f.WriteString("multi\\nl")
+		require.NoError(t, err)
+		entries, err := second.LoadNew()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, historyTexts(entries))
+
+		_, err = f.WriteString("ine\n\n")
+		require.NoError(t, err)
+		entries, err = second.LoadNew()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"multi\nline"}, historyTexts(entries))
+	})
+
+	t.Run("compacted by other", func(t *testing.T) {
+		require.NoError(t, first.Compact(textHistoryEntries("second 1", "first 2")))
+		require.NoError(t, first.Append(HistoryEntry{Text: "after compaction"}))
+
+		// The replaced file is read again, only unknown entries are returned.
+		entries, err := second.LoadNew()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"after compaction"}, historyTexts(entries))
+
+		require.NoError(t, first.Compact(textHistoryEntries("first 2", "after compaction")))
+		require.NoError(t, second.Append(HistoryEntry{Text: "from second"}))
+		entries, err = second.LoadNew()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, historyTexts(entries))
+		loaded, err := NewFileHistoryStore(path).Load()
+		assert.NoError(t, err)
+		// "multi\nline" is not loaded by the first session yet.
+		assert.Equal(t, []string{"first 2", "after compaction", "multi\nline", "from second"},
+			historyTexts(loaded))
+
+		require.NoError(t, first.Append(HistoryEntry{Text: "next"}))
+		entries, err = second.LoadNew()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"next"}, historyTexts(entries))
+	})
+}
+
+func TestFileHistoryStoreCompactShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	first := NewFileHistoryStore(path)
+	second := NewFileHistoryStore(path)
+	for _, store := range []*FileHistoryStore{first, second} {
+		_, err := store.Load()
+		require.NoError(t, err)
+	}
+
+	// "from-b 1" is read on appending, "from-b 2" is read on compaction.
+	require.NoError(t, second.Append(HistoryEntry{Text: "from-b 1"}))
+	require.NoError(t, first.Append(HistoryEntry{Text: "a"}))
+	require.NoError(t, second.Append(HistoryEntry{Text: "from-b 2"}))
+	require.NoError(t, first.Compact(textHistoryEntries("a")))
+
+	loaded, err := NewFileHistoryStore(path).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "from-b 1", "from-b 2"}, historyTexts(loaded))
+
+	entries, err := first.LoadNew()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"from-b 1", "from-b 2"}, historyTexts(entries))
+
+	// The loaded entries are not kept by the next compaction.
+	require.NoError(t, first.Compact(textHistoryEntries("a")))
+	loaded, err = NewFileHistoryStore(path).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, historyTexts(loaded))
+}
+
+func TestFileHistoryStoreCompactedByOther(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	first := NewFileHistoryStore(path)
+	second := NewFileHistoryStore(path)
+	for _, store := range []*FileHistoryStore{first, second} {
+		_, err := store.Load()
+		require.NoError(t, err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	entry := func(text string, i int) HistoryEntry {
+		return HistoryEntry{Text: text, Time: start.Add(time.Duration(i) * time.Second)}
+	}
+	require.NoError(t, first.Append(entry("a", 0)))
+	require.NoError(t, second.Append(entry("b", 1)))
+	entries, err := second.LoadNew()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, historyTexts(entries))
+
+	// The entries written by the compacting session are not lost.
+	require.NoError(t, first.Compact([]HistoryEntry{entry("a", 0)}))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, first.Append(entry("c", 2+i)))
+	}
+	entries, err = second.LoadNew()
+	assert.NoError(t, err)
+	require.Equal(t, []string{"c", "c", "c"}, historyTexts(entries))
+	assert.Equal(t, start.Add(4*time.Second), entries[2].Time)
+
+	// The entry with the same text and another time is new.
+	require.NoError(t, first.Compact([]HistoryEntry{entry("a", 0), entry("a", 5)}))
+	entries, err = second.LoadNew()
+	assert.NoError(t, err)
+	require.Equal(t, []string{"a"}, historyTexts(entries))
+	assert.Equal(t, start.Add(5*time.Second), entries[0].Time)
+}
+
+func TestFileHistoryStoreUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	first := NewFileHistoryStore(path)
+	second := NewFileHistoryStore(path)
+	for _, store := range []*FileHistoryStore{first, second} {
+		_, err := store.Load()
+		require.NoError(t, err)
+	}
+
+	entry := HistoryEntry{Text: "long", Time: time.Unix(1700000000, 123456789)}
+	require.NoError(t, first.Append(entry))
+	// The entry is visible to other sessions during the execution.
+	require.NoError(t, second.Append(HistoryEntry{Text: "other"}))
+
+	entry.Duration, entry.Status = 2*time.Second, "ok"
+	require.NoError(t, first.Update(entry))
+	require.NoError(t, second.Append(HistoryEntry{Text: "next"}))
+
+	// The results are applied to the pending entry.
+	entries, err := second.LoadNew()
+	assert.NoError(t, err)
+	require.Equal(t, []string{"long"}, historyTexts(entries))
+	assert.Equal(t, 2*time.Second, entries[0].Duration)
+	assert.Equal(t, "ok", entries[0].Status)
+
+	loaded, err := NewFileHistoryStore(path).Load()
+	assert.NoError(t, err)
+	require.Equal(t, []string{"long", "other", "next"}, historyTexts(loaded))
+	assert.Equal(t, 2*time.Second, loaded[0].Duration)
+	assert.Equal(t, "ok", loaded[0].Status)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data),
+		`#+{"text":"long","time":1700000000123,"duration":2000,"status":"ok"}`+"\n")
+}
+
+func TestFileHistoryStoreUnterminatedLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	require.NoError(t, ioutil.WriteFile(path, []byte("first\nsecond"), 0600))
+	store := NewFileHistoryStore(path)
+
+	// The last line is read at the end of the file.
+	entries, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, historyTexts(entries))
+
+	// The last line is terminated before appending.
+	require.NoError(t, store.Append(HistoryEntry{Text: "third"}))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\nthird\n", string(data))
+
+	entries, err = NewFileHistoryStore(path).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "third"}, historyTexts(entries))
+}
+
+func TestFileHistoryStoreLoadNoLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileHistoryStore(filepath.Join(dir, "history"))
+	_, err = store.Load()
+	require.NoError(t, err)
+	_, err = store.LoadNew()
+	require.NoError(t, err)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "the lock file is not created for reading")
+}
+
+func TestHistoryUnusableStore(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "f")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0600))
+	var prompt *Prompt
+	failed := map[string]error{}
+	require.NotPanics(t, func() {
+		prompt = New(
+			func(string) {},
+			func(Document) []Suggest { return nil },
+			OptionHistory([]string{"initial"}),
+			OptionHistoryStore(NewFileHistoryStore(filepath.Join(file, "h"))),
+			OptionHistoryNamespace("sql", NewFileHistoryStore(filepath.Join(file, "sql"))),
+			OptionHistoryStoreErrorHandler(func(namespace string, err error) {
+				failed[namespace] = err
+			}),
+		)
+	})
+
+	// The errors are reported to the handler.
+	assert.Len(t, failed, 2)
+	assert.Error(t, failed[DefaultHistoryNamespace])
+	assert.Error(t, failed["sql"])
+	assert.Contains(t, failed["sql"].Error(), "the history is kept in memory")
+
+	// The history is kept in memory.
+	assert.Nil(t, prompt.history.store)
+	prompt.history.Add("next")
+	assert.Equal(t, []string{"initial", "next"}, historyTexts(prompt.history.histories))
+	assert.Nil(t, prompt.histories["sql"].store)
+}
+
+func TestHistoryWithStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileHistoryStore(filepath.Join(dir, "history"))
+	require.NoError(t, store.Append(HistoryEntry{Text: "stored"}))
+
+	h := NewHistory()
+	h.Add("initial")
+	h.store = store
+	require.NoError(t, h.load())
+	assert.Equal(t, []string{"stored", "initial"}, historyTexts(h.histories))
+	assert.Equal(t, []string{"stored", "initial", ""}, h.tmp)
+
+	h.Add("new\nline")
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stored", "new\nline"}, historyTexts(loaded))
+
+	h.histories = h.histories[2:]
+	require.NoError(t, h.compact())
+	loaded, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new\nline"}, historyTexts(loaded))
+}
+
+func TestHistoryAutoCompactShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	first, second := NewHistory(), NewHistory()
+	for _, h := range []*History{first, second} {
+		h.store = NewFileHistoryStore(path)
+		h.policy = HistoryPolicy{EraseDups: true}
+		require.NoError(t, h.load())
+	}
+
+	first.Add("a1")
+	first.Add("a2")
+	second.Add("b1")
+	second.Add("b2")
+	// The erased duplicates make the store large enough to be compacted.
+	first.Add("a1")
+	first.Add("a2")
+	first.Add("a1")
+	require.Equal(t, 2, first.storeSize, "the store is compacted")
+
+	loaded, err := NewFileHistoryStore(path).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a2", "a1", "b1", "b2"}, historyTexts(loaded))
+}
@@ -1,20 +1,37 @@
 package prompt
 
 import (
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// textHistoryEntries returns history entries without metadata.
+func textHistoryEntries(texts ...string) []HistoryEntry {
+	entries := make([]HistoryEntry, len(texts))
+	for i, text := range texts {
+		entries[i] = HistoryEntry{Text: text}
+	}
+	return entries
+}
+
 func TestHistoryClear(t *testing.T) {
 	h := NewHistory()
 	h.Add("foo")
 	h.Clear()
 	expected := &History{
-		histories: []string{"foo"},
+		histories: []HistoryEntry{NewHistoryEntry("foo")},
 		tmp:       []string{"foo", ""},
 		selected:  1,
+		executing: -1,
+	}
+	if len(h.histories) == 1 {
+		// The time is checked by TestHistoryAddEntry.
+		expected.histories[0].Time = h.histories[0].Time
 	}
 	if !reflect.DeepEqual(expected, h) {
 		t.Errorf("Should be %#v, but got %#v", expected, h)
@@ -25,15 +42,37 @@ func TestHistoryAdd(t *testing.T) {
 	h := NewHistory()
 	h.Add("echo 1")
 	expected := &History{
-		histories: []string{"echo 1"},
+		histories: []HistoryEntry{NewHistoryEntry("echo 1")},
 		tmp:       []string{"echo 1", ""},
 		selected:  1,
+		executing: -1,
+	}
+	if len(h.histories) == 1 {
+		// The time is checked by TestHistoryAddEntry.
+		expected.histories[0].Time = h.histories[0].Time
 	}
 	if !reflect.DeepEqual(h, expected) {
 		t.Errorf("Should be %v, but got %v", expected, h)
 	}
 }
 
+func TestHistoryAddEntry(t *testing.T) {
+	h := NewHistory()
+	entry := HistoryEntry{Text: "echo 1", Time: time.Unix(1700000000, 0), Dir: "/tmp"}
+	h.AddEntry(entry)
+	assert.Equal(t, []HistoryEntry{entry}, h.Entries())
+
+	// Add sets the metadata of the entry.
+	before := time.Now()
+	h.Add("echo 2")
+	entries := h.Entries()
+	assert.Equal(t, "echo 2", entries[1].Text)
+	assert.False(t, entries[1].Time.Before(before))
+	dir, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, dir, entries[1].Dir)
+}
+
 func TestHistoryOlder(t *testing.T) {
 	h := NewHistory()
 	h.Add("echo 1")
@@ -90,3 +129,295 @@ func TestHistoryFindMatch(t *testing.T) {
 	assert.Equal(t, 0, history.FindMatch("line", 5))
 	assert.Equal(t, -1, history.FindMatch("line 10", 5))
 }
+
+// sharedHistoryStoreStub is a SharedHistoryStore and UpdatableHistoryStore stub,
+// newEntries imitate entries of other sessions, updates are the stored results.
+type sharedHistoryStoreStub struct {
+	entries    []HistoryEntry
+	newEntries []HistoryEntry
+	updates    []HistoryEntry
+}
+
+func (s *sharedHistoryStoreStub) Load() ([]HistoryEntry, error) {
+	return s.entries, nil
+}
+
+func (s *sharedHistoryStoreStub) Append(entry HistoryEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *sharedHistoryStoreStub) Compact(entries []HistoryEntry) error {
+	s.entries = entries
+	return nil
+}
+
+func (s *sharedHistoryStoreStub) Update(entry HistoryEntry) error {
+	s.updates = append(s.updates, entry)
+	return nil
+}
+
+func (s *sharedHistoryStoreStub) LoadNew() ([]HistoryEntry, error) {
+	entries := s.newEntries
+	s.newEntries = nil
+	return entries, nil
+}
+
+func TestHistoryShare(t *testing.T) {
+	cases := []struct {
+		mode     HistoryShareMode
+		expected []string
+	}{
+		{
+			mode:     HistoryShareDisabled,
+			expected: []string{"old", "local 1", "local 2"},
+		},
+		{
+			mode:     HistoryShareChronological,
+			expected: []string{"old", "local 1", "other 1", "other 2", "local 2", "other 3"},
+		},
+		{
+			mode:     HistoryShareLocalFirst,
+			expected: []string{"old", "other 1", "other 2", "other 3", "local 1", "local 2"},
+		},
+	}
+
+	for _, tc := range cases {
+		store := &sharedHistoryStoreStub{entries: textHistoryEntries("old")}
+		h := NewHistory()
+		h.store = store
+		h.shareMode = tc.mode
+		assert.NoError(t, h.load())
+
+		h.Add("local 1")
+		store.newEntries = textHistoryEntries("other 1", "other 2")
+		h.Add("local 2")
+		store.newEntries = textHistoryEntries("other 3")
+
+		buf := NewBuffer()
+		buf.InsertText("typed", false, true)
+		buf, changed := h.Older(buf)
+		assert.True(t, changed)
+		assert.Equal(t, tc.expected[len(tc.expected)-1], buf.Text())
+		assert.Equal(t, tc.expected, historyTexts(h.histories))
+
+		buf, changed = h.Newer(buf)
+		assert.True(t, changed)
+		assert.Equal(t, "typed", buf.Text())
+	}
+}
+
+func TestHistoryExecutingEntry(t *testing.T) {
+	store := &sharedHistoryStoreStub{}
+	h := NewHistory()
+	h.store = store
+
+	// The entry is persisted on start, the results are stored as an update.
+	h.start(HistoryEntry{Text: "cmd"})
+	assert.Equal(t, []HistoryEntry{{Text: "cmd"}}, store.entries)
+	h.setStatus("error")
+	h.finish(time.Second)
+	assert.Equal(t, []HistoryEntry{{Text: "cmd"}}, store.entries)
+	assert.Equal(t, []HistoryEntry{{Text: "cmd", Duration: time.Second, Status: "error"}},
+		store.updates)
+	assert.Equal(t, store.updates, h.Entries())
+
+	// The status is not set when there is no executing entry.
+	h.setStatus("ok")
+	h.finish(time.Second)
+	assert.Equal(t, "error", h.histories[0].Status)
+	assert.Equal(t, 1, len(store.updates))
+
+	// The rejected entry is not executing.
+	h.policy.IgnoreDups = true
+	h.start(HistoryEntry{Text: "cmd"})
+	h.setStatus("ok")
+	h.finish(time.Second)
+	assert.Equal(t, "error", h.histories[0].Status)
+	assert.Equal(t, 1, len(store.entries))
+	assert.Equal(t, 1, len(store.updates))
+
+	// There is nothing to update without the results.
+	h.start(HistoryEntry{Text: "other"})
+	h.finish(0)
+	assert.Equal(t, 2, len(store.entries))
+	assert.Equal(t, 1, len(store.updates))
+
+	// The entry returned by Input is finished by the status.
+	h.start(HistoryEntry{Text: "input"})
+	h.finishOnStatus = true
+	h.started = time.Now().Add(-time.Second)
+	h.setStatus("ok")
+	require.Equal(t, 2, len(store.updates))
+	assert.Equal(t, "ok", store.updates[1].Status)
+	assert.True(t, store.updates[1].Duration >= time.Second)
+	h.setStatus("error")
+	assert.Equal(t, 2, len(store.updates))
+}
+
+func TestHistoryWithPrefix(t *testing.T) {
+	h := NewHistory()
+	for _, entry := range []string{"box.cfg{}", "print(1)", "box.info", "box.info", "x"} {
+		h.Add(entry)
+	}
+
+	buf := NewBuffer()
+	buf.InsertText("box.space", false, true)
+	buf.setCursorPosition(len("box."))
+
+	buf, changed := h.OlderWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "box.info", buf.Text())
+	assert.Equal(t, len("box."), buf.cursorPosition)
+	assert.Equal(t, 3, h.selected)
+
+	// Skip the same command.
+	buf, changed = h.OlderWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "box.cfg{}", buf.Text())
+	assert.Equal(t, 0, h.selected)
+
+	// Edits are preserved.
+	buf.InsertText("edited", false, false)
+	buf, changed = h.OlderWithPrefix(buf)
+	assert.False(t, changed)
+	buf, changed = h.NewerWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "box.info", buf.Text())
+	buf, changed = h.OlderWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "box.editedcfg{}", buf.Text())
+
+	// The current input is always reachable.
+	buf, _ = h.NewerWithPrefix(buf)
+	buf, changed = h.NewerWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "box.space", buf.Text())
+	assert.Equal(t, len("box."), buf.cursorPosition)
+	buf, changed = h.NewerWithPrefix(buf)
+	assert.False(t, changed)
+
+	// Empty prefix walks through all the entries.
+	buf.setCursorPosition(0)
+	buf, changed = h.OlderWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "x", buf.Text())
+}
+
+func TestHistoryWithPrefixShortInput(t *testing.T) {
+	h := NewHistory()
+	h.Add("box.cfg{}")
+
+	buf := NewBuffer()
+	buf.InsertText("b", false, true)
+	buf, changed := h.OlderWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, 1, buf.cursorPosition)
+
+	// The prefix is longer than the input line.
+	buf.setCursorPosition(len("box.cfg{}"))
+	buf, changed = h.NewerWithPrefix(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "b", buf.Text())
+	assert.Equal(t, 1, buf.cursorPosition)
+}
+
+func TestHistoryOldestNewest(t *testing.T) {
+	h := NewHistory()
+	h.Add("first")
+	h.Add("second")
+
+	buf := NewBuffer()
+	buf.InsertText("typed", false, true)
+	buf, changed := h.Oldest(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "first", buf.Text())
+	_, changed = h.Oldest(buf)
+	assert.False(t, changed)
+
+	buf, changed = h.Newest(buf)
+	assert.True(t, changed)
+	assert.Equal(t, "typed", buf.Text())
+	_, changed = h.Newest(buf)
+	assert.False(t, changed)
+}
+
+func TestHistoryYankLastArg(t *testing.T) {
+	h := NewHistory()
+	h.Add(`echo "a b"`)
+	h.Add("   ")
+	h.Add("cat file.txt")
+
+	buf := NewBuffer()
+	buf.InsertText("vim ", false, true)
+	h.yankLastArg(buf)
+	assert.Equal(t, "vim file.txt", buf.Text())
+
+	// Cycle back on repeat.
+	h.yankLastArg(buf)
+	assert.Equal(t, `vim "a b"`, buf.Text())
+
+	// Stay at the oldest entry.
+	h.yankLastArg(buf)
+	assert.Equal(t, `vim "a b"`, buf.Text())
+
+	// Start again after an edit.
+	buf.InsertText(" ", false, true)
+	h.yankLastArg(buf)
+	assert.Equal(t, `vim "a b" file.txt`, buf.Text())
+}
+
+func TestHistoryNext(t *testing.T) {
+	h := NewHistory()
+	for _, entry := range []string{"a", "b", "c"} {
+		h.Add(entry)
+	}
+
+	// Nothing is requested.
+	_, ok := h.takeNext()
+	assert.False(t, ok)
+
+	// The accepted entry is added to the history.
+	h.selected = 0
+	h.requestNext("a")
+	h.Add("a")
+	buf, ok := h.takeNext()
+	assert.True(t, ok)
+	assert.Equal(t, "b", buf.Text())
+	assert.Equal(t, 1, h.selected)
+
+	// The accepted entry is not added.
+	h.requestNext("b")
+	buf, ok = h.takeNext()
+	assert.True(t, ok)
+	assert.Equal(t, "c", buf.Text())
+	assert.Equal(t, 2, h.selected)
+
+	// The last entry is followed by the accepted one.
+	h.selected = 3
+	h.requestNext("a")
+	h.Add("a")
+	buf, ok = h.takeNext()
+	assert.True(t, ok)
+	assert.Equal(t, "a", buf.Text())
+	assert.Equal(t, 4, h.selected)
+
+	// The new line has no next entry.
+	h.Clear()
+	h.requestNext("d")
+	h.Add("d")
+	_, ok = h.takeNext()
+	assert.False(t, ok)
+}
+
+func TestHistorySuggest(t *testing.T) {
+	h := NewHistory()
+	h.Add("select * from t")
+	h.Add("select 1")
+	h.Add("box.info")
+
+	assert.Equal(t, "ect 1", h.suggest("sel"))
+	assert.Equal(t, " from t", h.suggest("select *"))
+	assert.Equal(t, "", h.suggest("box.info"))
+	assert.Equal(t, "", h.suggest("unknown"))
+}
@@ -1,6 +1,9 @@
 package prompt
 
-import "bytes"
+import (
+	"bytes"
+	"strconv"
+)
 
 // WinSize represents the width and height of terminal.
 type WinSize struct {
@@ -30,6 +33,50 @@ func GetKey(b []byte) Key {
 	return NotDefined
 }
 
+// parseCPR parses the cursor position report "ESC [ row ; col R".
+// The row and the column start from 1.
+func parseCPR(b []byte) (row, col int, ok bool) {
+	if len(b) < 6 || b[0] != 0x1b || b[1] != '[' || b[len(b)-1] != 'R' {
+		return 0, 0, false
+	}
+	parts := bytes.Split(b[2:len(b)-1], []byte{';'})
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	row, err := strconv.Atoi(string(parts[0]))
+	if err != nil || row < 1 {
+		return 0, 0, false
+	}
+	col, err = strconv.Atoi(string(parts[1]))
+	if err != nil || col < 1 {
+		return 0, 0, false
+	}
+	return row, col, true
+}
+
+// findCPR finds the cursor position report in the input, which may contain
+// other bytes around it, and returns the input without the report.
+func findCPR(b []byte) (row, col int, rest []byte, ok bool) {
+	for i := bytes.IndexByte(b, 0x1b); i != -1 && i+1 < len(b); {
+		end := i + 2
+		for end < len(b) && (b[end] == ';' || ('0' <= b[end] && b[end] <= '9')) {
+			end++
+		}
+		if end < len(b) {
+			if row, col, ok = parseCPR(b[i : end+1]); ok {
+				rest = append(append([]byte{}, b[:i]...), b[end+1:]...)
+				return row, col, rest, true
+			}
+		}
+		next := bytes.IndexByte(b[i+1:], 0x1b)
+		if next == -1 {
+			break
+		}
+		i += 1 + next
+	}
+	return 0, 0, b, false
+}
+
 // ASCIISequences holds mappings of the key and byte array.
 var ASCIISequences = []*ASCIICode{
 	{Key: Escape, ASCIICode: []byte{0x1b}},
@@ -165,6 +212,12 @@ var ASCIISequences = []*ASCIICode{
 	{Key: ControlRight, ASCIICode: []byte{0x1b, 0x5b, 0x4f, 0x63}}, // rxvt
 	{Key: ControlLeft, ASCIICode: []byte{0x1b, 0x5b, 0x4f, 0x64}},  // rxvt
 
+	{Key: AltDot, ASCIICode: []byte{0x1b, 0x2e}},
+	{Key: AltUnderscore, ASCIICode: []byte{0x1b, 0x5f}},
+	{Key: AltLessThan, ASCIICode: []byte{0x1b, 0x3c}},
+	{Key: AltGreaterThan, ASCIICode: []byte{0x1b, 0x3e}},
+	{Key: AltF, ASCIICode: []byte{0x1b, 0x66}},
+
 	{Key: Ignore, ASCIICode: []byte{0x1b, 0x5b, 0x45}}, // Xterm
 	{Key: Ignore, ASCIICode: []byte{0x1b, 0x5b, 0x46}}, // Linux console
 }
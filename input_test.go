@@ -1,6 +1,7 @@
 package prompt
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -31,3 +32,54 @@ func TestPosixParserGetKey(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCPR(t *testing.T) {
+	scenarioTable := []struct {
+		input []byte
+		row   int
+		col   int
+		ok    bool
+	}{
+		{input: []byte("\x1b[12;5R"), row: 12, col: 5, ok: true},
+		{input: []byte("\x1b[1;2R"), row: 1, col: 2, ok: true},
+		{input: []byte("\x1b[12R")},
+		{input: []byte("\x1b[0;1R")},
+		{input: []byte("\x1b[a;1R")},
+		{input: []byte("\x1b[1;2A")},
+	}
+
+	for _, s := range scenarioTable {
+		t.Run(string(s.input[1:]), func(t *testing.T) {
+			row, col, ok := parseCPR(s.input)
+			if row != s.row || col != s.col || ok != s.ok {
+				t.Errorf("Should be (%d, %d, %v), but got (%d, %d, %v)",
+					s.row, s.col, s.ok, row, col, ok)
+			}
+		})
+	}
+}
+
+func TestFindCPR(t *testing.T) {
+	scenarioTable := []struct {
+		input []byte
+		row   int
+		rest  []byte
+		ok    bool
+	}{
+		{input: []byte("\x1b[12;5R"), row: 12, rest: []byte{}, ok: true},
+		{input: []byte("ls\x1b[5;1R"), row: 5, rest: []byte("ls"), ok: true},
+		{input: []byte("\x1b[A\x1b[5;1Rx"), row: 5, rest: []byte("\x1b[Ax"), ok: true},
+		{input: []byte("\x1b[1;2A\x1b"), rest: []byte("\x1b[1;2A\x1b")},
+		{input: []byte("ls"), rest: []byte("ls")},
+	}
+
+	for _, s := range scenarioTable {
+		t.Run(string(s.input), func(t *testing.T) {
+			row, _, rest, ok := findCPR(s.input)
+			if row != s.row || !bytes.Equal(rest, s.rest) || ok != s.ok {
+				t.Errorf("Should be (%d, %q, %v), but got (%d, %q, %v)",
+					s.row, s.rest, s.ok, row, rest, ok)
+			}
+		})
+	}
+}
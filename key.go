@@ -125,4 +125,12 @@ const (
 
 	// Key is not defined
 	NotDefined
+
+	// Alt (Meta) key combinations. They are defined after the other keys
+	// to keep the values of the existing ones.
+	AltDot
+	AltUnderscore
+	AltLessThan
+	AltGreaterThan
+	AltF
 )
@@ -19,6 +19,11 @@ func DeleteChar(buf *Buffer) {
 
 // DeleteWord Delete word before the cursor.
 func DeleteWord(buf *Buffer) {
+	if buf.tokenizer != nil {
+		start := buf.Document().FindTokenStartBackwardCursor(buf.tokenizer)
+		buf.DeleteBeforeCursor(buf.cursorPosition - start)
+		return
+	}
 	buf.DeleteBeforeCursor(len([]rune(buf.Document().TextBeforeCursor())) -
 		buf.Document().FindStartOfPreviousWordWithSpace())
 }
@@ -58,6 +63,10 @@ func GoLeftChar(buf *Buffer) {
 
 // GoRightWord moves the cursor to the end of the next word.
 func GoRightWord(buf *Buffer) {
+	if buf.tokenizer != nil {
+		buf.setCursorPosition(buf.Document().FindTokenEndForwardCursor(buf.tokenizer))
+		return
+	}
 	buf.setCursorPosition(buf.Document().FindWordEndForwardCursor(func(r rune) bool {
 		return r != '\n' && r != ' '
 	}))
@@ -65,6 +74,10 @@ func GoRightWord(buf *Buffer) {
 
 // GoLeftWord moves the cursor to the beginning of the previous word.
 func GoLeftWord(buf *Buffer) {
+	if buf.tokenizer != nil {
+		buf.setCursorPosition(buf.Document().FindTokenStartBackwardCursor(buf.tokenizer))
+		return
+	}
 	buf.setCursorPosition(buf.Document().FindWordStartBackwardCursor(func(r rune) bool {
 		return r != '\n' && r != ' '
 	}))
@@ -79,3 +92,38 @@ func GoCmdBeginning(buf *Buffer) {
 func GoCmdEnd(buf *Buffer) {
 	buf.setCursorPosition(len([]rune(buf.Text())))
 }
+
+// OperateAndGetNext accepts the input like Enter does and loads the history
+// entry next to the current one for editing after that. It allows to execute
+// a sequence of commands from the history.
+func OperateAndGetNext(buf *Buffer) {
+	buf.acceptAndGetNext = true
+}
+
+// YankLastArg inserts the last word of the previous command. Repeated calls
+// replace the inserted word with the last word of the older commands.
+func YankLastArg(buf *Buffer) {
+	if buf.history != nil {
+		buf.history.yankLastArg(buf)
+	}
+}
+
+// BeginningOfHistory loads the first entry of the history.
+func BeginningOfHistory(buf *Buffer) {
+	if buf.history == nil {
+		return
+	}
+	if newBuf, changed := buf.history.Oldest(buf); changed {
+		buf.replaceText(newBuf.Text())
+	}
+}
+
+// EndOfHistory loads the input line, which is being entered.
+func EndOfHistory(buf *Buffer) {
+	if buf.history == nil {
+		return
+	}
+	if newBuf, changed := buf.history.Newest(buf); changed {
+		buf.replaceText(newBuf.Text())
+	}
+}
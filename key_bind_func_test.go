@@ -193,3 +193,20 @@ func TestGoRightWord(t *testing.T) {
 		})
 	}
 }
+
+func TestWordMotionsTokenizer(t *testing.T) {
+	buf := NewBuffer()
+	buf.tokenizer = ShellTokenizer{}
+	buf.InsertText(`cp "my dir" x`, false, true)
+
+	GoLeftWord(buf)
+	assert.Equal(t, 12, buf.cursorPosition)
+	GoLeftWord(buf)
+	assert.Equal(t, 3, buf.cursorPosition)
+	GoRightWord(buf)
+	assert.Equal(t, 11, buf.cursorPosition)
+
+	DeleteWord(buf)
+	assert.Equal(t, "cp  x", buf.Text())
+	assert.Equal(t, 3, buf.cursorPosition)
+}
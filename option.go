@@ -1,6 +1,10 @@
 package prompt
 
-import "net"
+import (
+	"fmt"
+	"net"
+	"time"
+)
 
 const (
 	defaultTabWidth = 4
@@ -61,6 +65,132 @@ func OptionCompletionWordSeparator(x string) Option {
 	}
 }
 
+// OptionTokenizer sets the tokenizer, which finds the word before the cursor
+// to complete and the words for the word motions, for example ShellTokenizer
+// or LuaTokenizer. The word separators are not used with it. The accepted
+// suggestions are quoted by the tokenizer like the completed word unless
+// they have a replace range.
+func OptionTokenizer(t Tokenizer) Option {
+	return func(p *Prompt) error {
+		p.completion.tokenizer = t
+		return nil
+	}
+}
+
+// OptionAsyncCompleter sets the completer, which is called in the background
+// instead of the Completer passed to New, so a slow completer does not block
+// typing. The suggestions are shown when they are received.
+func OptionAsyncCompleter(completer AsyncCompleter) Option {
+	return func(p *Prompt) error {
+		p.completion.asyncCompleter = completer
+		p.completion.results = make(chan asyncResult)
+		return nil
+	}
+}
+
+// OptionCompletionDebounce sets the delay before the AsyncCompleter call.
+// The completer is not called until the input stops changing for the delay.
+func OptionCompletionDebounce(d time.Duration) Option {
+	return func(p *Prompt) error {
+		p.completion.debounce = d
+		return nil
+	}
+}
+
+// OptionCompletionLoadingIndicator sets the text shown in the completion
+// menu while the AsyncCompleter is running.
+func OptionCompletionLoadingIndicator(text string) Option {
+	return func(p *Prompt) error {
+		p.completion.loadingIndicator = text
+		return nil
+	}
+}
+
+// OptionCompletionLayout sets the layout of the completion menu.
+func OptionCompletionLayout(layout CompletionLayout) Option {
+	return func(p *Prompt) error {
+		p.completion.layout = layout
+		return nil
+	}
+}
+
+// OptionCompletionLayoutFunc sets the function, which chooses the layout
+// of the completion menu for every completion result.
+func OptionCompletionLayoutFunc(fn func(Document, []Suggest) CompletionLayout) Option {
+	return func(p *Prompt) error {
+		p.completion.layoutFunc = fn
+		return nil
+	}
+}
+
+// OptionCompletionCommonPrefix enables readline-like completion on Tab: it
+// inserts the longest common prefix of the suggestions first, the next Tab
+// cycles the suggestions. A single suggestion is inserted immediately.
+func OptionCompletionCommonPrefix() Option {
+	return func(p *Prompt) error {
+		p.isCommonPrefixCompletionEnabled = true
+		return nil
+	}
+}
+
+// OptionCompletionSingleSuffix sets the suffix like a space, which is inserted
+// after a single suggestion by OptionCompletionCommonPrefix.
+func OptionCompletionSingleSuffix(suffix string) Option {
+	return func(p *Prompt) error {
+		p.completionSingleSuffix = suffix
+		return nil
+	}
+}
+
+// OptionSuggestionAcceptCallback to run a callback with the suggestion
+// inserted from the completion menu.
+func OptionSuggestionAcceptCallback(fn func(Suggest)) Option {
+	return func(p *Prompt) error {
+		p.suggestionAcceptCallback = fn
+		return nil
+	}
+}
+
+// OptionCompletionMatchHighlight enables highlighting of the runes of
+// the suggestions fuzzy matched by the word before the cursor.
+func OptionCompletionMatchHighlight() Option {
+	return func(p *Prompt) error {
+		p.completion.highlightMatches = true
+		return nil
+	}
+}
+
+// OptionCompletionPosition enables showing of the number of the selected
+// suggestion and the number of the suggestions, like "12/340", in the scrollbar
+// area at the bottom of the menu.
+func OptionCompletionPosition() Option {
+	return func(p *Prompt) error {
+		p.renderer.completionPosition = true
+		return nil
+	}
+}
+
+// OptionCompletionPlacement to set the placement of the completion menu.
+// The row of the input is found by a cursor position request, the menu is
+// placed below the input if the terminal does not report it.
+func OptionCompletionPlacement(x CompletionPlacement) Option {
+	return func(p *Prompt) error {
+		p.renderer.completionPlacement = x
+		return nil
+	}
+}
+
+// OptionCompletionAdaptiveHeight to adapt the height of the completion menu
+// to the free rows of the terminal instead of OptionMaxSuggestion. The height
+// is at most x rows, 0 means no limit.
+func OptionCompletionAdaptiveHeight(x uint16) Option {
+	return func(p *Prompt) error {
+		p.renderer.adaptiveHeight = true
+		p.renderer.maxAdaptiveHeight = int(x)
+		return nil
+	}
+}
+
 // OptionLivePrefix to change the prefix dynamically by callback function.
 func OptionLivePrefix(f func() (prefix string, useLivePrefix bool)) Option {
 	return func(p *Prompt) error {
@@ -203,6 +333,144 @@ func OptionScrollbarBGColor(x Color) Option {
 	}
 }
 
+// OptionSearchMatchTextColor to change a text color of the matched substring in reverse search.
+func OptionSearchMatchTextColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.searchMatchTextColor = x
+		return nil
+	}
+}
+
+// OptionSearchMatchBGColor to change a background color of the matched substring in reverse search.
+func OptionSearchMatchBGColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.searchMatchBGColor = x
+		return nil
+	}
+}
+
+// OptionSuggestionMatchTextColor to change a text color of the matched characters
+// in the suggestions of the history picker and the highlighted completion menu.
+func OptionSuggestionMatchTextColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.suggestionMatchTextColor = x
+		return nil
+	}
+}
+
+// OptionGroupHeaderTextColor to change a text color of the group headers
+// in the completion menu.
+func OptionGroupHeaderTextColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.groupHeaderTextColor = x
+		return nil
+	}
+}
+
+// OptionGroupHeaderBGColor to change a background color of the group headers
+// in the completion menu.
+func OptionGroupHeaderBGColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.groupHeaderBGColor = x
+		return nil
+	}
+}
+
+// OptionAutoSuggestionTextColor to change a text color of the auto-suggestion.
+func OptionAutoSuggestionTextColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.autoSuggestionTextColor = x
+		return nil
+	}
+}
+
+// OptionAutoSuggestion enables fish-like auto-suggestions: the rest of
+// the newest history entry starting with the input is shown after the cursor.
+// Right or End at the end of the input accepts it, Alt+F accepts its next word.
+func OptionAutoSuggestion() Option {
+	return func(p *Prompt) error {
+		p.isAutoSuggestionEnabled = true
+		return nil
+	}
+}
+
+// OptionAutoSuggester enables the auto-suggestions like OptionAutoSuggestion,
+// but they are taken from the suggester instead of the history.
+func OptionAutoSuggester(suggester AutoSuggester) Option {
+	return func(p *Prompt) error {
+		p.isAutoSuggestionEnabled = true
+		p.autoSuggester = suggester
+		return nil
+	}
+}
+
+// OptionDocumentationTextColor to change a text color of the documentation panel.
+func OptionDocumentationTextColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.documentationTextColor = x
+		return nil
+	}
+}
+
+// OptionDocumentationBGColor to change a background color of the documentation panel.
+func OptionDocumentationBGColor(x Color) Option {
+	return func(p *Prompt) error {
+		p.renderer.documentationBGColor = x
+		return nil
+	}
+}
+
+// OptionDocumentationWidth specify the max width of the documentation panel.
+func OptionDocumentationWidth(x uint16) Option {
+	return func(p *Prompt) error {
+		p.renderer.documentationWidth = int(x)
+		return nil
+	}
+}
+
+// OptionDocumentationFunc sets the function, which returns the documentation
+// of the selected suggestion without Suggest.Documentation. It is called
+// lazily once for the selection. The documentation is shown in the panel
+// next to the completion menu and scrolled with Shift+Up and Shift+Down.
+func OptionDocumentationFunc(fn func(Suggest) string) Option {
+	return func(p *Prompt) error {
+		p.completion.documentationFunc = fn
+		return nil
+	}
+}
+
+// OptionHistoryPicker enables the history picker opened by the key. It shows
+// a fuzzy filtered list of the history entries from the newest to the oldest,
+// the selected entry is loaded to the buffer on Enter.
+func OptionHistoryPicker(key Key) Option {
+	return func(p *Prompt) error {
+		p.isHistoryPickerEnabled = true
+		p.historyPickerKey = key
+		return nil
+	}
+}
+
+// OptionHistoryExpansion enables bash-like history expansion of the entered
+// commands with ExpandHistory. It is performed before the execution and adding
+// to the history, expansion errors are shown instead of the execution.
+func OptionHistoryExpansion() Option {
+	return func(p *Prompt) error {
+		p.isHistoryExpansionEnabled = true
+		return nil
+	}
+}
+
+// OptionHistoryExpansionPreview enables the history expansion like
+// OptionHistoryExpansion, but the expanded command is loaded to the buffer
+// for editing instead of the execution, like bash histverify option does.
+func OptionHistoryExpansionPreview() Option {
+	return func(p *Prompt) error {
+		p.isHistoryExpansionEnabled = true
+		p.isHistoryExpansionPreview = true
+		return nil
+	}
+}
+
 // OptionMaxSuggestion specify the max number of displayed suggestions.
 func OptionMaxSuggestion(x uint16) Option {
 	return func(p *Prompt) error {
@@ -214,12 +482,12 @@ func OptionMaxSuggestion(x uint16) Option {
 // OptionHistory to set history expressed by string array.
 func OptionHistory(x []string) Option {
 	return func(p *Prompt) error {
-		histories := make([]string, 0, len(x))
+		histories := make([]HistoryEntry, 0, len(x))
 		for _, history := range x {
 			historyBuf := NewBuffer()
 			historyBuf.InsertText(history, false, true)
 			historyBuf = historyBuf.ReplaceTabs(defaultTabWidth)
-			histories = append(histories, historyBuf.Text())
+			histories = append(histories, HistoryEntry{Text: historyBuf.Text()})
 		}
 		p.history.histories = histories
 		p.history.Clear()
@@ -227,6 +495,78 @@ func OptionHistory(x []string) Option {
 	}
 }
 
+// OptionHistoryStore to set a persistent storage of the history.
+// Stored entries are loaded in New and every new entry is appended to the store.
+// If the store cannot be loaded, it is not used and the history is kept in memory.
+// The errors of the store are reported by OptionHistoryStoreErrorHandler.
+func OptionHistoryStore(x HistoryStore) Option {
+	return func(p *Prompt) error {
+		p.history.store = x
+		return nil
+	}
+}
+
+// OptionHistoryStoreErrorHandler to set a handler of the errors of the history
+// stores. It is called with the name of the history namespace and the error,
+// e.g. if the store cannot be loaded in New and the history is not persisted.
+func OptionHistoryStoreErrorHandler(fn func(namespace string, err error)) Option {
+	return func(p *Prompt) error {
+		p.historyStoreErrorHandler = fn
+		return nil
+	}
+}
+
+// OptionShareHistory to merge entries appended to the history store by other
+// sessions. The store should implement SharedHistoryStore.
+func OptionShareHistory(mode HistoryShareMode) Option {
+	return func(p *Prompt) error {
+		p.history.shareMode = mode
+		return nil
+	}
+}
+
+// OptionHistoryNamespace adds a named history namespace with its own store,
+// which may be nil. The namespace uses the policy and the share mode
+// of the default history. Use Prompt.SwitchHistory to make it active.
+func OptionHistoryNamespace(name string, store HistoryStore) Option {
+	return func(p *Prompt) error {
+		if _, ok := p.histories[name]; ok || name == DefaultHistoryNamespace {
+			return fmt.Errorf("history namespace %q already exists", name)
+		}
+		history := NewHistory()
+		history.store = store
+		p.histories[name] = history
+		return nil
+	}
+}
+
+// OptionHistoryNamespaceKey makes the key switch the active history namespace
+// to the one with the name.
+func OptionHistoryNamespaceKey(key Key, name string) Option {
+	return func(p *Prompt) error {
+		p.historyNamespaceKeys[key] = name
+		return nil
+	}
+}
+
+// OptionHistoryPolicy to set a policy, which defines the entries kept in the history.
+// The policy is applied to both automatically and manually pushed entries.
+func OptionHistoryPolicy(x HistoryPolicy) Option {
+	return func(p *Prompt) error {
+		p.history.policy = x
+		return nil
+	}
+}
+
+// OptionHistoryPrefixSearch makes Up and Down keys walk only through the history
+// entries, which start with the text before the cursor, if it is not empty.
+func OptionHistoryPrefixSearch() Option {
+	return func(p *Prompt) error {
+		p.isHistoryPrefixSearchEnabled = true
+		return nil
+	}
+}
+
 // OptionSwitchKeyBindMode set a key bind mode.
 func OptionSwitchKeyBindMode(m KeyBindMode) Option {
 	return func(p *Prompt) error {
@@ -243,6 +583,37 @@ func OptionCompletionOnDown() Option {
 	}
 }
 
+// OptionCompletionTrigger to set when the suggestions are shown.
+// The completer is not called while they are hidden.
+func OptionCompletionTrigger(x CompletionTrigger) Option {
+	return func(p *Prompt) error {
+		p.completion.trigger = x
+		return nil
+	}
+}
+
+// OptionCompletionMinLength to show the suggestions automatically when
+// the word before the cursor has at least x characters. It sets
+// the CompletionTriggerAuto trigger.
+func OptionCompletionMinLength(x uint) Option {
+	return func(p *Prompt) error {
+		p.completion.trigger = CompletionTriggerAuto
+		p.completion.minLength = int(x)
+		return nil
+	}
+}
+
+// OptionCompletionTriggerCharacters to show the suggestions automatically
+// after any of the characters, e.g. "." and ":" for Lua method access.
+// It sets the CompletionTriggerAuto trigger.
+func OptionCompletionTriggerCharacters(x string) Option {
+	return func(p *Prompt) error {
+		p.completion.trigger = CompletionTriggerAuto
+		p.completion.triggerCharacters = x
+		return nil
+	}
+}
+
 // SwitchKeyBindMode to set a key bind mode.
 // Deprecated: Please use OptionSwitchKeyBindMode.
 var SwitchKeyBindMode = OptionSwitchKeyBindMode
@@ -288,6 +659,8 @@ func OptionSetExitCheckerOnInput(fn ExitChecker) Option {
 }
 
 // OptionReverseSearch enables reverse search option.
+// Ctrl+R and Ctrl+S search backward and forward, Ctrl+G restores the buffer,
+// Escape and arrows accept the matched command without execution.
 func OptionReverseSearch() Option {
 	return func(p *Prompt) error {
 		p.isReverseSearchEnabled = true
@@ -295,6 +668,41 @@ func OptionReverseSearch() Option {
 	}
 }
 
+// OptionReverseSearchEntryInfo to show the metadata of the matched history entry
+// in the reverse search prefix. The metadata is formatted by the passed function,
+// e.g. HistoryEntryInfo.
+func OptionReverseSearchEntryInfo(fn func(HistoryEntry) string) Option {
+	return func(p *Prompt) error {
+		p.reverseSearchInfo = fn
+		return nil
+	}
+}
+
+// OptionSearchIgnoreCase makes the reverse search case-insensitive.
+func OptionSearchIgnoreCase() Option {
+	return func(p *Prompt) error {
+		p.searchIgnoreCase = true
+		return nil
+	}
+}
+
+// OptionSearchRegexp makes the reverse search treat the query as a regular expression.
+func OptionSearchRegexp() Option {
+	return func(p *Prompt) error {
+		p.searchRegexp = true
+		return nil
+	}
+}
+
+// OptionSearchPrefixFormats to change the prefix text in the reverse search mode.
+// Empty formats are replaced with the default ones.
+func OptionSearchPrefixFormats(x SearchPrefixFormats) Option {
+	return func(p *Prompt) error {
+		p.searchPrefixFormats = x
+		return nil
+	}
+}
+
 // OptionDisableAutoHistory disables auto pushes to the history.
 func OptionDisableAutoHistory() Option {
 	return func(p *Prompt) error {
@@ -343,6 +751,16 @@ func New(executor Executor, completer Completer, opts ...Option) *Prompt {
 			selectedDescriptionBGColor:   Cyan,
 			scrollbarThumbColor:          DarkGray,
 			scrollbarBGColor:             Cyan,
+			searchMatchTextColor:         Black,
+			searchMatchBGColor:           Yellow,
+			suggestionMatchTextColor:     DarkRed,
+			groupHeaderTextColor:         White,
+			groupHeaderBGColor:           DarkGray,
+			autoSuggestionTextColor:      DarkGray,
+			documentationTextColor:       Black,
+			documentationBGColor:         LightGray,
+			documentationWidth:           60,
+			promptRow:                    -1,
 		},
 		buf:         NewBuffer(),
 		executor:    executor,
@@ -350,6 +768,8 @@ func New(executor Executor, completer Completer, opts ...Option) *Prompt {
 		completion:  NewCompletionManager(completer, 6),
 		keyBindMode: EmacsKeyBind, // All the above assume that bash is running in the default
 		// Emacs setting
+		histories:            map[string]*History{},
+		historyNamespaceKeys: map[Key]string{},
 	}
 
 	for _, opt := range opts {
@@ -357,5 +777,25 @@ func New(executor Executor, completer Completer, opts ...Option) *Prompt {
 			panic(err)
 		}
 	}
+	pt.histories[DefaultHistoryNamespace] = pt.history
+	for name, history := range pt.histories {
+		if history != pt.history {
+			history.policy = pt.history.policy
+			history.shareMode = pt.history.shareMode
+		}
+		if handler := pt.historyStoreErrorHandler; handler != nil {
+			name := name
+			history.onStoreError = func(err error) { handler(name, err) }
+		}
+		if err := history.load(); err != nil {
+			history.storeError(fmt.Errorf(
+				"cannot load the store, the history is kept in memory: %w", err))
+		}
+	}
+	for _, name := range pt.historyNamespaceKeys {
+		if _, ok := pt.histories[name]; !ok {
+			panic(fmt.Errorf("unknown history namespace %q", name))
+		}
+	}
 	return pt
 }
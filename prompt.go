@@ -2,10 +2,13 @@ package prompt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/tarantool/go-prompt/internal/debug"
 )
@@ -25,21 +28,41 @@ type ExitChecker func(in string, breakline bool) bool
 // Completer should return the suggest item from Document.
 type Completer func(Document) []Suggest
 
+// AutoSuggester returns the text to suggest after the end of the document,
+// empty if there is nothing to suggest.
+type AutoSuggester func(Document) string
+
+// AsyncCompleter is like Completer, but it is called in the background.
+// The context is cancelled when the input is changed again, so the outdated
+// request may be aborted.
+type AsyncCompleter func(context.Context, Document) []Suggest
+
 // location indicates the relative location of the cursor on the screen.
 type location struct {
 	row int
 	col int
 }
 
+// textRange is a range of runes [start, end) in a text.
+type textRange struct {
+	start int
+	end   int
+}
+
 // renderCtx describes render context.
 type renderCtx struct {
 	cmd              *Buffer
+	input            *Document
 	cursor           location
 	endCursor        location
 	completion       *CompletionManager
 	prefixColor      Color
 	prefix           string
+	highlight        textRange
+	autoSuggestion   string
+	documentation    string
 	renderCompletion bool
+	skipPreview      bool
 	renderEvent      int
 }
 
@@ -47,17 +70,38 @@ type renderCtx struct {
 func (p *Prompt) fillCtx(renderEvent int) renderCtx {
 	cmd, _ := p.getCmdToRender()
 	prefix := p.getCurrentPrefix()
+	var highlight textRange
+	if p.inReverseSearchMode() {
+		prefixRunes := len([]rune(prefix))
+		highlight = textRange{
+			start: prefixRunes + p.reverseSearch.matchedStart,
+			end:   prefixRunes + p.reverseSearch.matchedEnd,
+		}
+	}
+
+	renderCompletion := !p.inReverseSearchMode() && !(p.buf.NewLineCount() > 0)
+	completion := p.completion
+	documentation := ""
+	if p.inHistoryPickerMode() {
+		completion = p.historyPicker.completion
+	} else if renderCompletion {
+		documentation = completion.documentation()
+	}
 
 	ctx := renderCtx{
-		cmd:         cmd,
-		cursor:      p.cursor,
-		endCursor:   p.endCursor,
-		completion:  p.completion,
-		prefixColor: p.renderer.prefixTextColor,
-		prefix:      prefix,
-		renderCompletion: !p.inReverseSearchMode() &&
-			!(p.buf.NewLineCount() > 0),
-		renderEvent: renderEvent,
+		cmd:              cmd,
+		input:            p.buf.Document(),
+		cursor:           p.cursor,
+		endCursor:        p.endCursor,
+		completion:       completion,
+		prefixColor:      p.renderer.prefixTextColor,
+		prefix:           prefix,
+		highlight:        highlight,
+		autoSuggestion:   p.autoSuggestion,
+		documentation:    documentation,
+		renderCompletion: renderCompletion,
+		skipPreview:      p.inHistoryPickerMode(),
+		renderEvent:      renderEvent,
 	}
 	return ctx
 }
@@ -90,9 +134,67 @@ type Prompt struct {
 	// isReverseSearchEnabled is true if such option was provided.
 	isReverseSearchEnabled bool
 
+	// reverseSearchInfo formats the metadata of the matched history entry
+	// to show it in the reverse-search prefix, nil if it is not shown.
+	reverseSearchInfo func(HistoryEntry) string
+
+	// searchIgnoreCase is true if the reverse-search is case-insensitive.
+	searchIgnoreCase bool
+
+	// searchRegexp is true if the reverse-search query is a regular expression.
+	searchRegexp bool
+
+	// searchPrefixFormats are formats of the prefix in the reverse-search mode.
+	searchPrefixFormats SearchPrefixFormats
+
+	// isHistoryPickerEnabled is true if the history picker is opened by historyPickerKey.
+	isHistoryPickerEnabled bool
+	historyPickerKey       Key
+	// historyPicker is a pointer to the opened history picker state.
+	// If the picker is closed, it is nil.
+	historyPicker *historyPicker
+
+	// histories are the history namespaces by their names,
+	// the active one is history.
+	histories map[string]*History
+	// historyNamespace is the name of the active history namespace.
+	historyNamespace string
+	// historyNamespaceKeys are the keys, which switch the active history namespace.
+	historyNamespaceKeys map[Key]string
+
+	// isHistoryExpansionEnabled is true if the entered commands are expanded
+	// with ExpandHistory before the execution.
+	isHistoryExpansionEnabled bool
+	// isHistoryExpansionPreview is true if the expanded command is loaded
+	// to the buffer for editing instead of the execution.
+	isHistoryExpansionPreview bool
+
 	// isAutoHistoryEnabled is true if automatic writing to the history is enabled.
 	isAutoHistoryEnabled bool
 
+	// isHistoryPrefixSearchEnabled is true if history navigation is anchored
+	// to the text before the cursor.
+	isHistoryPrefixSearchEnabled bool
+
+	// isAutoSuggestionEnabled is true if the auto-suggestion is shown
+	// after the cursor at the end of the input.
+	isAutoSuggestionEnabled bool
+	// autoSuggester returns the auto-suggestion, nil if it is taken
+	// from the history.
+	autoSuggester AutoSuggester
+	// autoSuggestion is the current auto-suggestion.
+	autoSuggestion string
+
+	// isCommonPrefixCompletionEnabled is true if Tab inserts the longest
+	// common prefix of the suggestions before selecting them.
+	isCommonPrefixCompletionEnabled bool
+	// completionSingleSuffix is inserted after a single suggestion on Tab.
+	completionSingleSuffix string
+	// suggestionAcceptCallback is called with the inserted suggestion.
+	suggestionAcceptCallback func(Suggest)
+	// historyStoreErrorHandler is called with the errors of the history stores.
+	historyStoreErrorHandler func(namespace string, err error)
+
 	// notifyConn is a connection used for rendering notifications.
 	notifyConn net.Conn
 }
@@ -116,10 +218,11 @@ func (p *Prompt) Run() {
 	defer p.tearDown()
 
 	if p.completion.showAtStart {
-		p.completion.Update(*p.buf.Document())
+		p.completion.Trigger(*p.buf.Document())
 	}
 
 	p.render(basicRenderEvent)
+	p.renderer.requestPromptRow(p.cursor)
 
 	bufCh := make(chan []byte, 128)
 	stopReadBufCh := make(chan struct{})
@@ -153,7 +256,11 @@ func (p *Prompt) Run() {
 				// Reset to Blocking mode because returned EAGAIN when still set non-blocking mode.
 				debug.AssertNoError(p.in.TearDown())
 
+				// The executor may switch the active history.
+				history := p.history
+				start := time.Now()
 				p.executor(e.input)
+				history.finish(time.Since(start))
 				p.render(basicRenderEvent)
 				p.notifyRender()
 
@@ -163,17 +270,26 @@ func (p *Prompt) Run() {
 				}
 				// Set raw mode
 				debug.AssertNoError(p.in.Setup())
+				// The response is not echoed in raw mode.
+				p.renderer.requestPromptRow(p.cursor)
 				go p.readBuffer(bufCh, stopReadBufCh)
 				go p.handleSignals(exitCh, winSizeCh, stopHandleSignalCh)
 			} else {
 				p.render(basicRenderEvent)
 				p.notifyRender()
+				p.renderer.requestPromptRow(p.cursor)
+			}
+		case r := <-p.completion.results:
+			if p.completion.applyAsyncResult(r) {
+				p.render(basicRenderEvent)
+				p.notifyRender()
 			}
 		case w := <-winSizeCh:
 			p.onInputUpdate()
-			p.renderer.UpdateWinSize(w)
+			p.updateWinSize(w)
 			p.render(windowResizeRenderEvent)
 			p.notifyRender()
+			p.renderer.requestPromptRow(p.cursor)
 		case code := <-exitCh:
 			p.onInputUpdate()
 			p.render(breakLineRenderEvent)
@@ -187,30 +303,45 @@ func (p *Prompt) Run() {
 }
 
 func (p *Prompt) feed(b []byte) (shouldExit bool, exec *Exec) {
+	if p.renderer.cprPending {
+		// The response may look like a key, e.g. F16, and may be read
+		// together with the typed keys.
+		if row, _, rest, ok := findCPR(b); ok {
+			p.renderer.setCursorRow(row)
+			if len(rest) == 0 {
+				return
+			}
+			b = rest
+		}
+	}
 	key := GetKey(b)
 
 	p.buf.lastKeyStroke = key
+	if p.inHistoryPickerMode() {
+		p.feedHistoryPicker(key, b)
+		return
+	}
+	if p.isHistoryPickerEnabled && key == p.historyPickerKey && !p.inReverseSearchMode() {
+		p.openHistoryPicker()
+		return
+	}
+	if name, ok := p.historyNamespaceKeys[key]; ok && !p.inReverseSearchMode() {
+		debug.AssertNoError(p.SwitchHistory(name))
+		return
+	}
+
 	// completion
 	completing := p.completion.Completing()
-	p.handleCompletionKeyBinding(key, completing)
+	if p.handleCompletionKeyBinding(key, completing) {
+		return
+	}
+	if !completing && p.acceptAutoSuggestion(key) {
+		return
+	}
 
 	switch key {
 	case Enter, ControlJ, ControlM:
-		execCmd := p.buf.Text()
-		if p.inReverseSearchMode() {
-			// Execute last matched command in case of enabled reverse search.
-			execCmd = p.reverseSearch.matchedCmd
-			p.disableReverseSearch()
-
-			// Render executed command before breakline.
-			p.render(basicRenderEvent)
-		}
-		p.render(breakLineRenderEvent)
-		p.buf = NewBuffer()
-		exec = &Exec{input: execCmd}
-		if exec.input != "" && p.isAutoHistoryEnabled {
-			p.history.Add(exec.input)
-		}
+		exec = p.accept(false)
 	case ControlC:
 		if p.inReverseSearchMode() {
 			p.disableReverseSearch()
@@ -223,7 +354,11 @@ func (p *Prompt) feed(b []byte) (shouldExit bool, exec *Exec) {
 			p.disableReverseSearch()
 		} else if !completing { // Don't use p.completion.Completing() because it takes double
 			// operation when switch to selected=-1.
-			if newBuf, changed := p.history.Older(p.buf); changed {
+			older := p.history.Older
+			if p.isHistoryPrefixSearchEnabled {
+				older = p.history.OlderWithPrefix
+			}
+			if newBuf, changed := older(p.buf); changed {
 				p.buf = newBuf
 			}
 		}
@@ -232,14 +367,22 @@ func (p *Prompt) feed(b []byte) (shouldExit bool, exec *Exec) {
 			p.disableReverseSearch()
 		} else if !completing { // Don't use p.completion.Completing() because it takes double
 			// operation when switch to selected=-1.
-			if newBuf, changed := p.history.Newer(p.buf); changed {
+			newer := p.history.Newer
+			if p.isHistoryPrefixSearchEnabled {
+				newer = p.history.NewerWithPrefix
+			}
+			if newBuf, changed := newer(p.buf); changed {
 				p.buf = newBuf
 			}
 		}
-	case Left, Right, ControlB, ControlF:
+	case Left, Right, ControlB, ControlF, Escape:
 		if p.inReverseSearchMode() {
 			p.disableReverseSearch()
 		}
+	case ControlG:
+		if p.inReverseSearchMode() {
+			p.abortReverseSearch()
+		}
 	case ControlD:
 		if p.buf.Text() == "" {
 			shouldExit = true
@@ -249,7 +392,13 @@ func (p *Prompt) feed(b []byte) (shouldExit bool, exec *Exec) {
 		if p.inReverseSearchMode() {
 			p.reverseSearch.reducePrefix()
 		} else {
-			p.enableReverseSearch()
+			p.enableReverseSearch(searchBackward)
+		}
+	case ControlS:
+		if p.inReverseSearchMode() {
+			p.reverseSearch.reduceSuffix()
+		} else {
+			p.enableReverseSearch(searchForward)
 		}
 	case NotDefined:
 		if p.handleASCIICodeBinding(b) {
@@ -259,37 +408,197 @@ func (p *Prompt) feed(b []byte) (shouldExit bool, exec *Exec) {
 	}
 
 	shouldExit = p.handleKeyBinding(key)
+	if p.buf.acceptAndGetNext && !shouldExit {
+		p.buf.acceptAndGetNext = false
+		exec = p.accept(true)
+	}
 	return
 }
 
-func (p *Prompt) handleCompletionKeyBinding(key Key, completing bool) {
+// accept accepts the input and returns the command to execute, nil if
+// there is nothing to execute. If getNext is true, the history entry next
+// to the accepted one is loaded to the buffer.
+func (p *Prompt) accept(getNext bool) (exec *Exec) {
+	execCmd := p.buf.Text()
+	if p.inReverseSearchMode() {
+		// Execute last matched command in case of enabled reverse search.
+		execCmd = p.reverseSearch.matchedCmd
+		p.disableReverseSearch()
+
+		// Render executed command before breakline.
+		p.render(basicRenderEvent)
+	}
+	expandedCmd, err := p.expandHistory(execCmd)
+	if err == nil && expandedCmd != execCmd && p.isHistoryExpansionPreview {
+		// Load the expanded command for editing instead of the execution.
+		p.buf = NewBuffer()
+		p.buf.InsertText(expandedCmd, false, true)
+		return nil
+	}
+	if getNext && err == nil {
+		p.history.requestNext(expandedCmd)
+	}
+	p.render(breakLineRenderEvent)
+	p.buf = NewBuffer()
+	p.completion.Reset()
+	if err != nil {
+		// Report the error without the execution.
+		p.renderer.renderMessage(err.Error())
+		p.history.Clear()
+		return nil
+	}
+	if expandedCmd != execCmd {
+		// Show the command, which is executed.
+		p.renderer.renderMessage(expandedCmd)
+	}
+	exec = &Exec{input: expandedCmd}
+	if exec.input != "" && p.isAutoHistoryEnabled {
+		p.history.start(NewHistoryEntry(exec.input))
+	}
+	if next, ok := p.history.takeNext(); ok {
+		p.buf = next
+	}
+	return exec
+}
+
+// handleCompletionKeyBinding handles the key in the completion menu. It returns
+// true if the key is consumed by the menu and must not be handled further.
+func (p *Prompt) handleCompletionKeyBinding(key Key, completing bool) bool {
 	switch key {
 	case Down:
+		if !completing && p.completionOnDown && !p.completion.shown() {
+			p.completion.Trigger(*p.buf.Document())
+		}
 		if completing || p.completionOnDown {
-			p.completion.Next()
+			p.completion.NextRow()
 		}
 	case Tab, ControlI:
+		if !completing && !p.completion.shown() {
+			p.completion.Trigger(*p.buf.Document())
+		}
+		if p.isCommonPrefixCompletionEnabled && !completing && p.insertCommonPrefix() {
+			return false
+		}
 		p.completion.Next()
 	case Up:
 		if completing {
-			p.completion.Previous()
+			p.completion.PreviousRow()
 		}
 	case BackTab:
 		p.completion.Previous()
-	default:
-		if s, ok := p.completion.GetSelectedSuggestion(); ok {
-			w := p.buf.Document().GetWordBeforeCursorUntilSeparator(p.completion.wordSeparator)
-			if w != "" {
-				p.buf.DeleteBeforeCursor(len([]rune(w)))
+	case PageDown, PageUp:
+		if completing || p.completion.shown() {
+			if key == PageDown {
+				p.completion.PageDown()
+			} else {
+				p.completion.PageUp()
+			}
+			return true
+		}
+	case Home, End:
+		if completing {
+			if key == Home {
+				p.completion.First()
+			} else {
+				p.completion.Last()
+			}
+			return true
+		}
+	case Escape, ControlG:
+		if !p.inReverseSearchMode() && (completing || p.completion.shown()) {
+			// Close the menu keeping the typed text. The menu shown while
+			// typing does not take the key from the key bindings.
+			consumed := completing || p.completion.triggered
+			p.completion.Cancel()
+			return consumed
+		}
+	case ShiftDown, ShiftUp:
+		if completing && p.completion.documentation() != "" {
+			if key == ShiftDown {
+				p.completion.ScrollDocumentation(1)
+			} else {
+				p.completion.ScrollDocumentation(-1)
+			}
+			return true
+		}
+		p.acceptCompletion()
+	case Left, Right:
+		if completing && p.completion.Layout() == CompletionLayoutGrid {
+			if key == Left {
+				p.completion.Previous()
+			} else {
+				p.completion.Next()
 			}
-			p.buf.InsertText(s.Text, false, true)
+			return true
 		}
+		p.acceptCompletion()
+	default:
+		p.acceptCompletion()
+	}
+	return false
+}
+
+// insertCommonPrefix completes the word before the cursor to the longest
+// common prefix of the suggestions. A single suggestion is inserted with
+// the suffix. It returns false if the word cannot be completed further.
+func (p *Prompt) insertCommonPrefix() bool {
+	suggests := p.completion.GetSuggestions()
+	if len(suggests) == 1 {
+		p.insertSuggestion(suggests[0], p.completionSingleSuffix)
 		p.completion.Reset()
+		return true
+	}
+	w, start := p.completion.word(*p.buf.Document())
+	prefix := commonPrefix(suggests)
+	if len(prefix) <= len(w) || !strings.HasPrefix(prefix, w) {
+		return false
+	}
+	quoted := p.completion.quote(prefix, p.buf.Document(), false)
+	p.buf.DeleteBeforeCursor(p.buf.cursorPosition - start)
+	p.buf.InsertText(quoted, false, true)
+	p.completion.Reset()
+	return true
+}
+
+// acceptCompletion inserts the selected suggestion and resets the completion.
+func (p *Prompt) acceptCompletion() {
+	if s, ok := p.completion.GetSelectedSuggestion(); ok {
+		p.insertSuggestion(s, "")
+		p.completion.Reset()
+	}
+}
+
+// insertSuggestion replaces the text in the range of the suggestion with
+// its text to insert and the suffix, then calls the acceptance callback.
+func (p *Prompt) insertSuggestion(s Suggest, suffix string) {
+	before, after := p.completion.replaceRange(s, p.buf.Document())
+	text := s.insertText()
+	if s.Replace == nil {
+		text = p.completion.quote(text, p.buf.Document(), true)
+	}
+	if before > 0 {
+		p.buf.DeleteBeforeCursor(before)
+	}
+	if after > 0 {
+		p.buf.Delete(after)
+	}
+	p.buf.InsertText(text+suffix, false, true)
+	if s.CursorOffset != 0 {
+		cursor := p.buf.cursorPosition + s.CursorOffset
+		if max := len([]rune(p.buf.Text())); cursor > max {
+			cursor = max
+		}
+		p.buf.setCursorPosition(cursor)
+	}
+	if p.suggestionAcceptCallback != nil {
+		p.suggestionAcceptCallback(s)
 	}
 }
 
 func (p *Prompt) handleKeyBinding(key Key) bool {
 	shouldExit := false
+	p.buf.history = p.history
+	p.buf.tokenizer = p.completion.tokenizer
 	for i := range commonKeyBindings {
 		kb := commonKeyBindings[i]
 		if kb.Key == key {
@@ -330,7 +639,8 @@ func (p *Prompt) handleASCIICodeBinding(b []byte) bool {
 	return checked
 }
 
-// Input just returns user input text.
+// Input just returns user input text. The results of its execution may be
+// stored in the history by SetHistoryStatus.
 func (p *Prompt) Input() string {
 	defer debug.Teardown()
 	debug.Log("start prompt")
@@ -338,10 +648,11 @@ func (p *Prompt) Input() string {
 	defer p.tearDown()
 
 	if p.completion.showAtStart {
-		p.completion.Update(*p.buf.Document())
+		p.completion.Trigger(*p.buf.Document())
 	}
 
 	p.render(basicRenderEvent)
+	p.renderer.requestPromptRow(p.cursor)
 	bufCh := make(chan []byte, 128)
 	stopReadBufCh := make(chan struct{})
 	go p.readBuffer(bufCh, stopReadBufCh)
@@ -356,10 +667,17 @@ func (p *Prompt) Input() string {
 			} else if e != nil {
 				// Stop goroutine to run readBuffer function
 				stopReadBufCh <- struct{}{}
+				// The entry is finished by SetHistoryStatus.
+				p.history.finishOnStatus = true
 				return e.input
 			} else {
 				p.onInputUpdate()
 				p.render(basicRenderEvent)
+				p.renderer.requestPromptRow(p.cursor)
+			}
+		case r := <-p.completion.results:
+			if p.completion.applyAsyncResult(r) {
+				p.render(basicRenderEvent)
 			}
 		default:
 			time.Sleep(10 * time.Millisecond)
@@ -386,11 +704,18 @@ func (p *Prompt) readBuffer(bufCh chan []byte, stopCh chan struct{}) {
 func (p *Prompt) setUp() {
 	debug.AssertNoError(p.in.Setup())
 	p.renderer.Setup(p.title)
-	p.renderer.UpdateWinSize(p.in.GetWinSize())
+	p.updateWinSize(p.in.GetWinSize())
+}
+
+// updateWinSize updates the window size for the rendering and the completion grid.
+func (p *Prompt) updateWinSize(ws *WinSize) {
+	p.renderer.UpdateWinSize(ws)
+	p.completion.width = int(ws.Col)
 }
 
 // tearDown restores the terminal state when prompt is turned off.
 func (p *Prompt) tearDown() {
+	p.completion.cancelAsync()
 	if !p.skipTearDown {
 		debug.AssertNoError(p.in.TearDown())
 	}
@@ -405,10 +730,12 @@ func (p *Prompt) getCmdToRender() (cmd *Buffer, prefixLen int) {
 	cmdBuf := NewBuffer()
 	cmdBuf.InsertText(prefix, false, true)
 	if p.inReverseSearchMode() {
+		// Place the cursor at the match like readline does.
 		cmdBuf.InsertText(p.reverseSearch.matchedCmd, false, true)
+		cmdBuf.setCursorPosition(len([]rune(prefix)) + p.reverseSearch.matchedStart)
 	} else {
 		cmdBuf.InsertText(input, false, true)
-		cmdBuf.setCursorPosition(len(prefix) + p.buf.cursorPosition)
+		cmdBuf.setCursorPosition(len([]rune(prefix)) + p.buf.cursorPosition)
 	}
 	return cmdBuf, len(prefix)
 }
@@ -417,12 +744,19 @@ func (p *Prompt) getCmdToRender() (cmd *Buffer, prefixLen int) {
 // If reverse search is enabled, its prefix extracted.
 // If live-prefix is enabled, return live-prefix.
 func (p *Prompt) getCurrentPrefix() string {
+	if p.inHistoryPickerMode() {
+		return fmt.Sprintf(historyPickerPrefixFmt, p.buf.Text())
+	}
 	if p.inReverseSearchMode() {
-		rsPrefixFmt := matchSearchPrefixFmt
-		if p.reverseSearch.matchedIndex == -1 {
-			rsPrefixFmt = failSearchPrefixFmt
+		rsPrefixFmt := p.reverseSearch.prefixFormat(p.searchPrefixFormats)
+		prefix := fmt.Sprintf(rsPrefixFmt, p.buf.Text())
+		entry, ok := p.history.entry(p.reverseSearch.matchedIndex)
+		if ok && p.reverseSearchInfo != nil {
+			if info := p.reverseSearchInfo(entry); info != "" {
+				prefix += fmt.Sprintf(searchInfoFmt, info)
+			}
 		}
-		return fmt.Sprintf(rsPrefixFmt, p.buf.Text())
+		return prefix
 	}
 	if prefix, ok := p.livePrefixCallback(); ok {
 		return prefix
@@ -433,12 +767,71 @@ func (p *Prompt) getCurrentPrefix() string {
 // onInputUpdate does necessary actions at the input update moment.
 func (p *Prompt) onInputUpdate() {
 	p.buf = p.buf.ReplaceTabs(defaultTabWidth)
+	p.autoSuggestion = ""
 	if p.inReverseSearchMode() {
 		p.reverseSearch.update(p.buf.Text())
 		return
 	}
+	if p.inHistoryPickerMode() {
+		p.historyPicker.update(p.buf.Text())
+		return
+	}
 	p.history.SetCurrentCmd(p.buf.Text())
 	p.completion.Update(*p.buf.Document())
+	p.updateAutoSuggestion()
+}
+
+// updateAutoSuggestion updates the auto-suggestion for the input. It is shown
+// only if the cursor is at the end of the input and no suggestion is selected.
+// Only the first line of the auto-suggestion is used.
+func (p *Prompt) updateAutoSuggestion() {
+	doc := p.buf.Document()
+	if !p.isAutoSuggestionEnabled || p.completion.Completing() ||
+		doc.Text == "" || doc.TextAfterCursor() != "" {
+		return
+	}
+	var suggestion string
+	if p.autoSuggester != nil {
+		suggestion = p.autoSuggester(*doc)
+	} else {
+		suggestion = p.history.suggest(doc.Text)
+	}
+	if i := strings.IndexAny(suggestion, "\r\n"); i >= 0 {
+		suggestion = suggestion[:i]
+	}
+	p.autoSuggestion = suggestion
+}
+
+// acceptAutoSuggestion inserts the auto-suggestion on Right or End and
+// its next word on Alt+F. It returns false if nothing is inserted.
+func (p *Prompt) acceptAutoSuggestion(key Key) bool {
+	if p.autoSuggestion == "" || p.inReverseSearchMode() ||
+		p.buf.Document().TextAfterCursor() != "" {
+		return false
+	}
+	text := p.autoSuggestion
+	switch key {
+	case Right, ControlF, End, ControlE:
+	case AltF:
+		text = firstWord(text)
+	default:
+		return false
+	}
+	p.buf.InsertText(text, false, true)
+	return true
+}
+
+// firstWord returns the beginning of the text up to the end of its first word.
+func firstWord(text string) string {
+	runes := []rune(text)
+	i := 0
+	for i < len(runes) && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	for i < len(runes) && !unicode.IsSpace(runes[i]) {
+		i++
+	}
+	return string(runes[:i])
 }
 
 // render renders current prompt state to the attached renderer,
@@ -453,14 +846,35 @@ func (p *Prompt) inReverseSearchMode() bool {
 	return p.reverseSearch != nil
 }
 
-// enableReverseSearch enables reverse-search mode.
-func (p *Prompt) enableReverseSearch() {
+// enableReverseSearch enables reverse-search mode in the direction.
+func (p *Prompt) enableReverseSearch(direction searchDirection) {
 	if !p.isReverseSearchEnabled || p.inReverseSearchMode() {
 		return
 	}
 
+	originalBuf := p.buf
 	p.buf = NewBuffer()
+	p.history.sync()
 	p.reverseSearch = NewReverseSearch(p.history)
+	p.reverseSearch.direction = direction
+	p.reverseSearch.ignoreCase = p.searchIgnoreCase
+	p.reverseSearch.useRegexp = p.searchRegexp
+	p.reverseSearch.originalBuf = originalBuf
+}
+
+// abortReverseSearch disables reverse-search mode,
+// restores the buffer, which was before the search.
+func (p *Prompt) abortReverseSearch() {
+	if !p.isReverseSearchEnabled || !p.inReverseSearchMode() {
+		return
+	}
+
+	if p.reverseSearch.originalBuf != nil {
+		p.buf = p.reverseSearch.originalBuf
+	} else {
+		p.buf = NewBuffer()
+	}
+	p.reverseSearch = nil
 }
 
 // disableReverseSearch disables reverse-search mode,
@@ -479,30 +893,157 @@ func (p *Prompt) disableReverseSearch() {
 		p.history.selected = matchedIndex
 		p.history.SetCurrentCmd(matchedCmd)
 		p.buf.InsertText(matchedCmd, false, true)
+		p.buf.setCursorPosition(p.reverseSearch.matchedStart)
 	}
 
 	p.reverseSearch = nil
 }
 
-// pushToHistory takes command, replaces tabs with spaces,
+// expandHistory expands the command with ExpandHistory,
+// if the history expansion is enabled.
+func (p *Prompt) expandHistory(cmd string) (string, error) {
+	if !p.isHistoryExpansionEnabled {
+		return cmd, nil
+	}
+	return ExpandHistory(cmd, historyTexts(p.history.histories))
+}
+
+// inHistoryPickerMode returns true if the history picker is opened.
+func (p *Prompt) inHistoryPickerMode() bool {
+	return p.historyPicker != nil
+}
+
+// openHistoryPicker opens the history picker, the buffer becomes its query.
+func (p *Prompt) openHistoryPicker() {
+	if !p.isHistoryPickerEnabled || p.inHistoryPickerMode() {
+		return
+	}
+
+	p.completion.Reset()
+	p.history.sync()
+	p.historyPicker = newHistoryPicker(p.history.histories, p.completion.max)
+	p.historyPicker.originalBuf = p.buf
+	p.buf = NewBuffer()
+}
+
+// feedHistoryPicker handles the key in the history picker mode.
+func (p *Prompt) feedHistoryPicker(key Key, b []byte) {
+	switch key {
+	case Enter, ControlJ, ControlM:
+		p.acceptHistoryPicker()
+	case Escape, ControlG, ControlC:
+		p.abortHistoryPicker()
+	case Up, ControlP, BackTab:
+		p.historyPicker.previous()
+	case Down, ControlN, Tab, ControlI:
+		p.historyPicker.next()
+	case NotDefined:
+		p.buf.InsertText(string(b), false, true)
+	default:
+		p.handleKeyBinding(key)
+	}
+}
+
+// acceptHistoryPicker closes the history picker and loads the selected entry
+// to the buffer for editing. If nothing is selected, the buffer is restored.
+func (p *Prompt) acceptHistoryPicker() {
+	entry, ok := p.historyPicker.selected()
+	if !ok {
+		p.abortHistoryPicker()
+		return
+	}
+
+	p.historyPicker = nil
+	p.history.Clear()
+	p.buf = NewBuffer()
+	p.buf.InsertText(entry.Text, false, true)
+}
+
+// abortHistoryPicker closes the history picker and restores the buffer,
+// which was before the picker was opened.
+func (p *Prompt) abortHistoryPicker() {
+	p.buf = p.historyPicker.originalBuf
+	p.historyPicker = nil
+}
+
+// pushToHistory takes an entry, replaces tabs with spaces in its command,
 // pushes it to the history.
-func (p *Prompt) pushToHistory(cmd string) {
+func (p *Prompt) pushToHistory(entry HistoryEntry) {
 	cmdBuf := NewBuffer()
-	cmdBuf.InsertText(cmd, false, true)
+	cmdBuf.InsertText(entry.Text, false, true)
 	cmdBuf = cmdBuf.ReplaceTabs(defaultTabWidth)
-	p.history.Add(cmdBuf.Text())
+	entry.Text = cmdBuf.Text()
+	p.history.AddEntry(entry)
 }
 
 // PushToHistory pushes to the history, if auto history is disabled.
 func (p *Prompt) PushToHistory(cmd string) error {
+	return p.PushHistoryEntry(NewHistoryEntry(cmd))
+}
+
+// PushHistoryEntry pushes the entry with its metadata to the history,
+// if auto history is disabled.
+func (p *Prompt) PushHistoryEntry(entry HistoryEntry) error {
 	if p.isAutoHistoryEnabled {
 		return fmt.Errorf("external pushes to the history are forbidden, " +
 			"use `OptionDisableAutoHistory`")
 	}
-	p.pushToHistory(cmd)
+	p.pushToHistory(entry)
 	return nil
 }
 
+// SetHistoryStatus sets the status of the history entry, which is being
+// executed. It should be called by the executor, if auto history is enabled.
+// The input returned by Input is considered executed by the call, so its
+// duration is the time since the input was accepted.
+func (p *Prompt) SetHistoryStatus(status string) {
+	// The executor may switch the active history.
+	p.history.setStatus(status)
+	for _, history := range p.histories {
+		if history != p.history {
+			history.setStatus(status)
+		}
+	}
+}
+
+// SwitchHistory makes the history namespace with the name active. The history
+// navigation, search and persistence use the active history. The default
+// history has the DefaultHistoryNamespace name.
+func (p *Prompt) SwitchHistory(name string) error {
+	history, ok := p.histories[name]
+	if !ok {
+		return fmt.Errorf("unknown history namespace %q", name)
+	}
+	if p.inReverseSearchMode() {
+		p.disableReverseSearch()
+	}
+	if p.inHistoryPickerMode() {
+		p.abortHistoryPicker()
+	}
+
+	p.history.Clear()
+	p.history = history
+	p.historyNamespace = name
+	p.history.Clear()
+	p.history.SetCurrentCmd(p.buf.Text())
+	return nil
+}
+
+// HistoryNamespace returns the name of the active history namespace.
+func (p *Prompt) HistoryNamespace() string {
+	return p.historyNamespace
+}
+
+// HistoryEntries returns the history entries from the oldest to the newest.
+func (p *Prompt) HistoryEntries() []HistoryEntry {
+	return p.history.Entries()
+}
+
+// CompactHistory rewrites the history store with the entries of the current history.
+func (p *Prompt) CompactHistory() error {
+	return p.history.compact()
+}
+
 // notifyAboutRender notifying about rendering if such option was provided.
 func (p *Prompt) notifyRender() {
 	if p.notifyConn != nil {
@@ -1,10 +1,16 @@
 package prompt
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetCurrentPrefix(t *testing.T) {
@@ -38,6 +44,21 @@ func TestGetCurrentPrefix(t *testing.T) {
 		assert.Equal(t, fmt.Sprintf(matchSearchPrefixFmt, "input"),
 			actualPrefix)
 	})
+
+	t.Run("reverse-search entry info", func(t *testing.T) {
+		prompt.history.AddEntry(HistoryEntry{Text: "cmd", Status: "error"})
+		prompt.history.AddEntry(HistoryEntry{Text: "cmd 2"})
+		prompt.reverseSearchInfo = HistoryEntryInfo
+		prompt.reverseSearch.matchedIndex = 0
+		actualPrefix := prompt.getCurrentPrefix()
+		assert.Equal(t, fmt.Sprintf(matchSearchPrefixFmt, "input")+fmt.Sprintf(searchInfoFmt, "error"),
+			actualPrefix)
+
+		// No info for an entry without metadata.
+		prompt.reverseSearch.matchedIndex = 1
+		actualPrefix = prompt.getCurrentPrefix()
+		assert.Equal(t, fmt.Sprintf(matchSearchPrefixFmt, "input"), actualPrefix)
+	})
 }
 
 func TestGetCmdToRender(t *testing.T) {
@@ -71,10 +92,38 @@ func TestGetCmdToRender(t *testing.T) {
 		expectedPrefx := fmt.Sprintf(matchSearchPrefixFmt, input)
 		assert.Equal(t, expectedPrefx+matchedCmd, cmdBuf.Text())
 		assert.Equal(t, len(expectedPrefx), prefixLen)
-		assert.Equal(t, len([]rune(matchedCmd))+len([]rune(expectedPrefx)), cmdBuf.cursorPosition)
+		// The cursor is placed at the match.
+		assert.Equal(t, len([]rune("print(`"))+len([]rune(expectedPrefx)), cmdBuf.cursorPosition)
 	})
 }
 
+func TestFillCtxHighlight(t *testing.T) {
+	prompt := &Prompt{
+		history:    NewHistory(),
+		buf:        NewBuffer(),
+		renderer:   &Render{},
+		completion: NewCompletionManager(nil, 6),
+		livePrefixCallback: func() (prefix string, useLivePrefix bool) {
+			return "", false
+		},
+	}
+	prompt.history.Add("if x then\n    строка(1)\nend")
+
+	ctx := prompt.fillCtx(basicRenderEvent)
+	assert.Equal(t, textRange{}, ctx.highlight)
+
+	prompt.reverseSearch = NewReverseSearch(prompt.history)
+	prompt.buf.InsertText("ока(", false, true)
+	prompt.reverseSearch.update(prompt.buf.Text())
+	assert.Equal(t, 17, prompt.reverseSearch.matchedStart)
+	assert.Equal(t, 21, prompt.reverseSearch.matchedEnd)
+
+	ctx = prompt.fillCtx(basicRenderEvent)
+	prefixLen := len([]rune(fmt.Sprintf(matchSearchPrefixFmt, "ока(")))
+	assert.Equal(t, textRange{start: prefixLen + 17, end: prefixLen + 21}, ctx.highlight)
+	assert.Equal(t, prefixLen+17, ctx.cmd.cursorPosition)
+}
+
 func TestInReverseSearchMode(t *testing.T) {
 	prompt := &Prompt{history: NewHistory()}
 	assert.False(t, prompt.inReverseSearchMode())
@@ -93,7 +142,7 @@ func TestEnableReverseSearch(t *testing.T) {
 
 	t.Run("basic", func(t *testing.T) {
 		prompt.buf.InsertText("multi\nline", false, true)
-		prompt.enableReverseSearch()
+		prompt.enableReverseSearch(searchBackward)
 		assert.Equal(t, "", prompt.buf.Text())
 		assert.NotNil(t, prompt.reverseSearch)
 		prompt.reverseSearch = nil
@@ -102,12 +151,38 @@ func TestEnableReverseSearch(t *testing.T) {
 	t.Run("disabled option", func(t *testing.T) {
 		prompt.buf.InsertText("multi\nline", false, true)
 		prompt.isReverseSearchEnabled = false
-		prompt.enableReverseSearch()
+		prompt.enableReverseSearch(searchBackward)
 		assert.Nil(t, prompt.reverseSearch)
 		assert.Equal(t, "multi\nline", prompt.buf.Text())
 	})
 }
 
+func TestAbortReverseSearch(t *testing.T) {
+	history := NewHistory()
+	history.Add("entry 1")
+
+	prompt := &Prompt{
+		isReverseSearchEnabled: true,
+		history:                history,
+		buf:                    NewBuffer(),
+		searchIgnoreCase:       true,
+	}
+	prompt.buf.InsertText("typed", false, true)
+
+	prompt.enableReverseSearch(searchForward)
+	assert.Equal(t, searchForward, prompt.reverseSearch.direction)
+	assert.True(t, prompt.reverseSearch.ignoreCase)
+	prompt.buf.InsertText("ENTRY", false, true)
+	prompt.reverseSearch.reducePrefix()
+	prompt.reverseSearch.update(prompt.buf.Text())
+	assert.Equal(t, "entry 1", prompt.reverseSearch.matchedCmd)
+
+	prompt.abortReverseSearch()
+	assert.Nil(t, prompt.reverseSearch)
+	assert.Equal(t, "typed", prompt.buf.Text())
+	assert.Equal(t, len(history.tmp)-1, history.selected)
+}
+
 func TestDisableReverseSearch(t *testing.T) {
 	history := NewHistory()
 	history.Add("entry 11")
@@ -125,6 +200,7 @@ func TestDisableReverseSearch(t *testing.T) {
 	prompt.disableReverseSearch()
 	assert.Nil(t, prompt.reverseSearch)
 	assert.Equal(t, "entry 11", prompt.buf.Text())
+	assert.Equal(t, 0, prompt.buf.cursorPosition)
 	assert.Equal(t, 0, history.selected)
 
 	// Haven't match.
@@ -169,9 +245,721 @@ func TestPushToHistory(t *testing.T) {
 func TestInternalPushToHistory(t *testing.T) {
 	prompt := Prompt{history: NewHistory()}
 	cmd := "if something then\n\tprint(1)\nelse\n\tprint(2)"
-	prompt.pushToHistory(cmd)
+	prompt.pushToHistory(HistoryEntry{Text: cmd})
 
 	assert.Equal(t, 1, len(prompt.history.histories))
 	assert.Equal(t, "if something then\n    print(1)\nelse\n    print(2)",
-		prompt.history.histories[0])
+		prompt.history.histories[0].Text)
+}
+
+func TestHistoryPickerMode(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{} },
+		OptionHistory([]string{"box.cfg{}", "print(1)", "box.info"}),
+		OptionHistoryPicker(ControlT),
+	)
+	feed := func(b string) {
+		prompt.feed([]byte(b))
+		prompt.onInputUpdate()
+	}
+
+	feed("typed")
+	feed("\x14")
+	assert.True(t, prompt.inHistoryPickerMode())
+	assert.Equal(t, "", prompt.buf.Text())
+	assert.Equal(t, fmt.Sprintf(historyPickerPrefixFmt, ""), prompt.getCurrentPrefix())
+
+	t.Run("abort", func(t *testing.T) {
+		feed("bx")
+		feed("\x07")
+		assert.False(t, prompt.inHistoryPickerMode())
+		assert.Equal(t, "typed", prompt.buf.Text())
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		feed("\x14")
+		feed("bx")
+		feed("\x1b[B")
+		entry, ok := prompt.historyPicker.selected()
+		assert.True(t, ok)
+		assert.Equal(t, "box.cfg{}", entry.Text)
+		feed("\r")
+		assert.False(t, prompt.inHistoryPickerMode())
+		assert.Equal(t, "box.cfg{}", prompt.buf.Text())
+		assert.Equal(t, "box.cfg{}", prompt.history.tmp[prompt.history.selected])
+	})
+}
+
+func TestHistoryPickerNonASCIIQuery(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{} },
+		OptionHistory([]string{"café au lait"}),
+		OptionHistoryPicker(ControlT),
+		OptionWriter(&mockConsoleWriter{w: &bytes.Buffer{}}),
+	)
+	prompt.updateWinSize(&WinSize{Row: 20, Col: 80})
+	prompt.feed([]byte("\x14"))
+	prompt.feed([]byte("café"))
+	prompt.onInputUpdate()
+
+	cmd, _ := prompt.getCmdToRender()
+	assert.Equal(t, len([]rune(cmd.Text())), cmd.cursorPosition)
+	assert.NotPanics(t, func() { prompt.render(0) })
+}
+
+func TestHistoryPickerNarrowTerminal(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	for col := uint16(10); col < 20; col++ {
+		prompt := New(
+			func(s string) {},
+			func(d Document) []Suggest { return []Suggest{} },
+			OptionHistory([]string{"box.cfg{}", "box.info"}),
+			OptionHistoryPicker(ControlT),
+			OptionWriter(&mockConsoleWriter{w: &bytes.Buffer{}}),
+		)
+		prompt.updateWinSize(&WinSize{Row: 20, Col: col})
+		for _, key := range []string{"\x14", "\t", "\x1b[B"} {
+			prompt.feed([]byte(key))
+			prompt.onInputUpdate()
+			assert.NotPanics(t, func() { prompt.render(0) }, "%d columns", col)
+		}
+	}
+}
+
+func TestHistoryExpansionOnEnter(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	newPrompt := func(opts ...Option) (*Prompt, *bytes.Buffer) {
+		opts = append(opts, OptionHistory([]string{"box.info", "print(1)"}))
+		prompt := New(
+			func(s string) {},
+			func(d Document) []Suggest { return []Suggest{} },
+			opts...,
+		)
+		out := &bytes.Buffer{}
+		prompt.renderer.out = &mockConsoleWriter{w: out}
+		prompt.renderer.col = 80
+		return prompt, out
+	}
+
+	t.Run("expansion", func(t *testing.T) {
+		prompt, out := newPrompt(OptionHistoryExpansion())
+		prompt.feed([]byte("x = !b"))
+		_, exec := prompt.feed([]byte("\r"))
+		assert.NotNil(t, exec)
+		assert.Equal(t, "x = box.info", exec.input)
+		assert.Contains(t, out.String(), "x = box.info\n")
+		prompt.history.finish(0)
+		assert.Equal(t, "x = box.info", prompt.history.histories[2].Text)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		prompt, out := newPrompt(OptionHistoryExpansion())
+		prompt.feed([]byte("!x"))
+		_, exec := prompt.feed([]byte("\r"))
+		assert.Nil(t, exec)
+		assert.Contains(t, out.String(), "!x: event not found\n")
+		assert.Equal(t, "", prompt.buf.Text())
+		assert.Equal(t, 2, len(prompt.history.histories))
+	})
+
+	t.Run("preview", func(t *testing.T) {
+		prompt, _ := newPrompt(OptionHistoryExpansionPreview())
+		prompt.feed([]byte("!!"))
+		_, exec := prompt.feed([]byte("\r"))
+		assert.Nil(t, exec)
+		assert.Equal(t, "print(1)", prompt.buf.Text())
+
+		_, exec = prompt.feed([]byte("\r"))
+		assert.NotNil(t, exec)
+		assert.Equal(t, "print(1)", exec.input)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		prompt, _ := newPrompt()
+		prompt.feed([]byte("!!"))
+		_, exec := prompt.feed([]byte("\r"))
+		assert.Equal(t, "!!", exec.input)
+	})
+}
+
+func TestOperateAndGetNext(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{} },
+		OptionHistory([]string{"first", "second", "third"}),
+	)
+	prompt.renderer.out = &mockConsoleWriter{w: &bytes.Buffer{}}
+	prompt.renderer.col = 80
+	feed := func(b string) *Exec {
+		_, exec := prompt.feed([]byte(b))
+		prompt.onInputUpdate()
+		return exec
+	}
+
+	// Alt+<
+	feed("\x1b<")
+	assert.Equal(t, "first", prompt.buf.Text())
+
+	for _, expected := range []string{"first", "second", "third"} {
+		exec := feed("\x0f")
+		assert.NotNil(t, exec)
+		assert.Equal(t, expected, exec.input)
+		prompt.history.finish(0)
+	}
+	assert.Equal(t, "first", prompt.buf.Text())
+
+	// Alt+>
+	feed("\x1b>")
+	assert.Equal(t, "", prompt.buf.Text())
+
+	// Alt+.
+	feed("echo ")
+	feed("\x1b.")
+	assert.Equal(t, "echo third", prompt.buf.Text())
+	feed("\x1b_")
+	assert.Equal(t, "echo second", prompt.buf.Text())
+}
+
+func TestHistoryNamespaces(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir("", "go-prompt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	luaStore := NewFileHistoryStore(filepath.Join(dir, "lua"))
+	sqlStore := NewFileHistoryStore(filepath.Join(dir, "sql"))
+	require.NoError(t, sqlStore.Append(HistoryEntry{Text: "SELECT 1"}))
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{} },
+		OptionHistoryStore(luaStore),
+		OptionHistoryPolicy(HistoryPolicy{IgnoreSpace: true}),
+		OptionHistoryNamespace("sql", sqlStore),
+		OptionHistoryNamespaceKey(ControlT, "sql"),
+	)
+	assert.Equal(t, DefaultHistoryNamespace, prompt.HistoryNamespace())
+	assert.True(t, prompt.histories["sql"].policy.IgnoreSpace)
+
+	prompt.history.AddEntry(HistoryEntry{Text: "box.info"})
+
+	// Switch by the key keeps the input.
+	prompt.feed([]byte("typed"))
+	prompt.feed([]byte{0x14})
+	assert.Equal(t, "sql", prompt.HistoryNamespace())
+	assert.Equal(t, "typed", prompt.buf.Text())
+	prompt.feed([]byte("\x1b[A"))
+	assert.Equal(t, "SELECT 1", prompt.buf.Text())
+
+	// The status is set for the executing entry after the switch.
+	prompt.history.start(HistoryEntry{Text: "SELECT 2"})
+	require.NoError(t, prompt.SwitchHistory(DefaultHistoryNamespace))
+	prompt.SetHistoryStatus("error")
+	prompt.histories["sql"].finish(0)
+
+	entries, err := sqlStore.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []HistoryEntry{{Text: "SELECT 1"}, {Text: "SELECT 2", Status: "error"}}, entries)
+	entries, err = luaStore.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"box.info"}, historyTexts(entries))
+
+	assert.EqualError(t, prompt.SwitchHistory("unknown"), `unknown history namespace "unknown"`)
+	assert.Panics(t, func() {
+		New(func(s string) {}, func(d Document) []Suggest { return nil },
+			OptionHistoryNamespace(DefaultHistoryNamespace, nil))
+	})
+	assert.Panics(t, func() {
+		New(func(s string) {}, func(d Document) []Suggest { return nil },
+			OptionHistoryNamespaceKey(ControlT, "unknown"))
+	})
+}
+
+func TestCompletionGridKeys(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			return []Suggest{{Text: "aa"}, {Text: "ab"}, {Text: "ac"}}
+		},
+		OptionCompletionLayout(CompletionLayoutGrid),
+	)
+	prompt.completion.width = 80
+	prompt.feed([]byte("a"))
+	prompt.onInputUpdate()
+
+	// Tab selects, Right and Left move in the grid.
+	prompt.feed([]byte{0x9})
+	prompt.onInputUpdate()
+	prompt.feed([]byte("\x1b[C"))
+	prompt.onInputUpdate()
+	assert.Equal(t, 1, prompt.completion.selected)
+	prompt.feed([]byte("\x1b[D"))
+	prompt.onInputUpdate()
+	assert.Equal(t, 0, prompt.completion.selected)
+	assert.Equal(t, "a", prompt.buf.Text())
+	assert.Equal(t, 1, prompt.buf.cursorPosition)
+
+	// Other keys accept the suggestion.
+	prompt.feed([]byte(" "))
+	assert.Equal(t, "aa ", prompt.buf.Text())
+}
+
+func TestAutoSuggestion(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{} },
+		OptionHistory([]string{"box.cfg{}", "box.info.memory()\nreturn"}),
+		OptionAutoSuggestion(),
+	)
+	feed := func(b []byte) {
+		prompt.feed(b)
+		prompt.onInputUpdate()
+	}
+
+	feed([]byte("box"))
+	assert.Equal(t, ".info.memory()", prompt.autoSuggestion, "only the first line")
+	assert.Equal(t, ".info.memory()", prompt.fillCtx(basicRenderEvent).autoSuggestion)
+
+	// Alt+F accepts the next word.
+	feed([]byte{0x1b, 'f'})
+	assert.Equal(t, "box.info.memory()", prompt.buf.Text())
+	assert.Equal(t, "", prompt.autoSuggestion)
+
+	feed([]byte{0x7f})
+	feed([]byte{0x7f})
+	assert.Equal(t, "()", prompt.autoSuggestion)
+
+	// Nothing is shown with the cursor in the middle.
+	feed([]byte("\x1b[D"))
+	assert.Equal(t, "", prompt.autoSuggestion)
+	feed([]byte("\x1b[C"))
+	assert.Equal(t, "box.info.memory", prompt.buf.Text())
+
+	// Right accepts the whole suggestion.
+	feed([]byte("\x1b[C"))
+	assert.Equal(t, "box.info.memory()", prompt.buf.Text())
+	assert.Equal(t, 17, prompt.buf.cursorPosition)
+
+	// Alt+F moves the cursor without the suggestion.
+	prompt.buf = NewBuffer()
+	prompt.buf.InsertText("a b", false, false)
+	feed([]byte{0x1b, 'f'})
+	assert.Equal(t, "a b", prompt.buf.Text())
+	assert.Equal(t, 1, prompt.buf.cursorPosition)
+
+	prompt = New(
+		func(s string) {},
+		func(d Document) []Suggest { return []Suggest{{Text: "box"}} },
+		OptionAutoSuggester(func(d Document) string { return "_" + d.Text }),
+	)
+	prompt.feed([]byte("b"))
+	prompt.onInputUpdate()
+	assert.Equal(t, "_b", prompt.autoSuggestion)
+
+	// Nothing is shown while a suggestion is selected.
+	prompt.feed([]byte{0x9})
+	prompt.onInputUpdate()
+	assert.Equal(t, "", prompt.autoSuggestion)
+}
+
+func TestCompletionCommonPrefix(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	suggests := []Suggest{{Text: "box.cfg"}, {Text: "box.info"}, {Text: "box.info.memory"}}
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			return FilterHasPrefix(suggests, d.GetWordBeforeCursor(), false)
+		},
+		OptionCompletionCommonPrefix(),
+		OptionCompletionSingleSuffix(" "),
+	)
+	feed := func(b []byte) {
+		prompt.feed(b)
+		prompt.onInputUpdate()
+	}
+
+	feed([]byte("b"))
+	feed([]byte{0x9})
+	assert.Equal(t, "box.", prompt.buf.Text())
+	assert.False(t, prompt.completion.Completing())
+
+	// The next Tab cycles the suggestions.
+	feed([]byte{0x9})
+	assert.Equal(t, "box.", prompt.buf.Text())
+	s, ok := prompt.completion.GetSelectedSuggestion()
+	assert.True(t, ok)
+	assert.Equal(t, "box.cfg", s.Text)
+	feed([]byte{0x9})
+	s, _ = prompt.completion.GetSelectedSuggestion()
+	assert.Equal(t, "box.info", s.Text)
+
+	// A single suggestion is inserted with the suffix.
+	prompt.buf = NewBuffer()
+	prompt.completion.Reset()
+	feed([]byte("box.info.m"))
+	feed([]byte{0x9})
+	assert.Equal(t, "box.info.memory ", prompt.buf.Text())
+	assert.False(t, prompt.completion.Completing())
+}
+
+func TestCompletionTokenizer(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	suggests := []Suggest{{Text: "my dir/file1"}, {Text: "my dir/file2"}, {Text: "my docs"}}
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			return FilterHasPrefix(suggests, d.GetTokenBeforeCursor(ShellTokenizer{}).Value, false)
+		},
+		OptionTokenizer(ShellTokenizer{}),
+		OptionCompletionCommonPrefix(),
+		OptionCompletionSingleSuffix(" "),
+	)
+	feed := func(b []byte) {
+		prompt.feed(b)
+		prompt.onInputUpdate()
+	}
+
+	// The common prefix keeps the quote open.
+	feed([]byte(`ls "my di`))
+	feed([]byte{0x9})
+	assert.Equal(t, `ls "my dir/file`, prompt.buf.Text())
+
+	feed([]byte("1"))
+	feed([]byte{0x9})
+	assert.Equal(t, `ls "my dir/file1" `, prompt.buf.Text())
+
+	// An unquoted word is escaped.
+	prompt.buf = NewBuffer()
+	prompt.completion.Reset()
+	feed([]byte(`ls my\ do`))
+	feed([]byte{0x9})
+	assert.Equal(t, `ls my\ docs `, prompt.buf.Text())
+}
+
+func TestRichSuggestion(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	var accepted []Suggest
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			return []Suggest{
+				{
+					Text:         "select",
+					Display:      "select(key, opts)",
+					Insert:       "select()",
+					Replace:      &SuggestRange{Start: 4, End: 8},
+					CursorOffset: -1,
+					Payload:      42,
+				},
+			}
+		},
+		OptionSuggestionAcceptCallback(func(s Suggest) {
+			accepted = append(accepted, s)
+		}),
+	)
+	prompt.buf.InsertText("box.seXX", false, true)
+	prompt.buf.setCursorPosition(6)
+	prompt.onInputUpdate()
+
+	prompt.feed([]byte{0x9})
+	prompt.onInputUpdate()
+	prompt.feed([]byte("k"))
+	assert.Equal(t, "box.select(k)", prompt.buf.Text())
+	assert.Equal(t, 12, prompt.buf.cursorPosition)
+	require.Len(t, accepted, 1)
+	assert.Equal(t, 42, accepted[0].Payload)
+}
+
+func TestCompletionMenuKeys(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			return []Suggest{{Text: "aa"}, {Text: "ab"}, {Text: "ac"}, {Text: "ad"}}
+		},
+		OptionMaxSuggestion(2),
+	)
+	input := func(b string) {
+		prompt.feed([]byte(b))
+		prompt.onInputUpdate()
+	}
+	input("a")
+
+	// PageDown selects the last suggestion of the first page.
+	input("\x1b[6~")
+	assert.Equal(t, 1, prompt.completion.selected)
+	input("\x1b[F")
+	assert.Equal(t, 3, prompt.completion.selected, "End selects the last one")
+	input("\x1b[H")
+	assert.Equal(t, 0, prompt.completion.selected, "Home selects the first one")
+	assert.Equal(t, "a", prompt.buf.Text())
+
+	// Escape closes the menu keeping the typed text.
+	input("\x1b")
+	assert.False(t, prompt.completion.Completing())
+	assert.False(t, prompt.completion.shown())
+	assert.Equal(t, "a", prompt.buf.Text())
+
+	// Home and End move the cursor while nothing is selected.
+	input("\x1b[H")
+	assert.Equal(t, 0, prompt.buf.cursorPosition)
+	input("\x1b[F")
+	assert.Equal(t, 1, prompt.buf.cursorPosition)
+
+	// Tab reopens the menu, Ctrl+G closes it again.
+	input("\t")
+	assert.True(t, prompt.completion.shown())
+	input("\x07")
+	assert.False(t, prompt.completion.shown())
+	assert.Equal(t, "a", prompt.buf.Text())
+
+	// Typing reopens the menu.
+	input("b")
+	assert.True(t, prompt.completion.shown())
+	assert.Equal(t, "ab", prompt.buf.Text())
+}
+
+func TestCompletionMenuKeyBindings(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	called := 0
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			return []Suggest{{Text: "aa"}, {Text: "ab"}}
+		},
+		OptionAddKeyBind(KeyBind{Key: Escape, Fn: func(*Buffer) { called++ }}),
+	)
+	input := func(b string) {
+		prompt.feed([]byte(b))
+		prompt.onInputUpdate()
+	}
+
+	// The menu shown by typing is closed and the key binding is called.
+	input("a")
+	assert.True(t, prompt.completion.shown())
+	input("\x1b")
+	assert.False(t, prompt.completion.shown())
+	assert.Equal(t, "a", prompt.buf.Text())
+	assert.Equal(t, 1, called)
+
+	// The selected suggestion is cancelled without the key binding.
+	input("\t")
+	assert.True(t, prompt.completion.Completing())
+	input("\x1b")
+	assert.False(t, prompt.completion.shown())
+	assert.Equal(t, 1, called)
+}
+
+func TestCompletionTriggerTab(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	calls := 0
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest {
+			calls++
+			return FilterHasPrefix([]Suggest{{Text: "aa"}, {Text: "ab"}},
+				d.GetWordBeforeCursor(), false)
+		},
+		OptionCompletionTrigger(CompletionTriggerTab),
+	)
+	input := func(b string) {
+		prompt.feed([]byte(b))
+		prompt.onInputUpdate()
+	}
+	input("a")
+	assert.False(t, prompt.completion.shown())
+	assert.Equal(t, 0, calls)
+
+	// Tab shows the menu and selects the first suggestion.
+	input("\t")
+	assert.True(t, prompt.completion.shown())
+	assert.Equal(t, 0, prompt.completion.selected)
+
+	// The accepted suggestion hides the menu.
+	input(" ")
+	assert.Equal(t, "aa ", prompt.buf.Text())
+	assert.False(t, prompt.completion.shown())
+	calls = 0
+	input("a")
+	assert.Equal(t, 0, calls)
+
+	// The menu shown by Tab at the line start is hidden on the next line.
+	prompt.renderer.out = &mockConsoleWriter{w: &bytes.Buffer{}}
+	prompt.updateWinSize(&WinSize{Row: 20, Col: 80})
+	prompt.buf = NewBuffer()
+	prompt.completion.Reset()
+	input("\t")
+	assert.True(t, prompt.completion.shown())
+	input("\r")
+	assert.Equal(t, "", prompt.buf.Text())
+	assert.False(t, prompt.completion.shown())
+	calls = 0
+	input("a")
+	assert.False(t, prompt.completion.shown())
+	assert.Equal(t, 0, calls)
+}
+
+func TestFeedCPR(t *testing.T) {
+	oldGetInputParser := getInputParser
+	defer func() {
+		getInputParser = oldGetInputParser
+	}()
+	getInputParser = func() *PosixParser {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	prompt := New(
+		func(s string) {},
+		func(d Document) []Suggest { return nil },
+		OptionWriter(&mockConsoleWriter{w: &buffer}),
+		OptionCompletionPlacement(CompletionPlacementAuto),
+	)
+	prompt.cursor = location{row: 1, col: 4}
+	prompt.renderer.requestPromptRow(prompt.cursor)
+	assert.Equal(t, "\x1b[6n", buffer.String())
+	assert.True(t, prompt.renderer.cprPending)
+
+	// The response is not handled as a key.
+	prompt.feed([]byte("\x1b[1;2R"))
+	assert.False(t, prompt.renderer.cprPending)
+	assert.Equal(t, -1, prompt.renderer.promptRow, "the input is not visible")
+	assert.Equal(t, "", prompt.buf.Text())
+
+	prompt.renderer.requestPromptRow(prompt.cursor)
+	prompt.feed([]byte("\x1b[12;5R"))
+	assert.Equal(t, 10, prompt.renderer.promptRow)
+
+	// The row is requested only once.
+	buffer.Reset()
+	prompt.renderer.requestPromptRow(prompt.cursor)
+	assert.Empty(t, buffer.String())
+
+	// The response is read together with the typed keys.
+	prompt.renderer.promptRow = -1
+	prompt.renderer.requestPromptRow(prompt.cursor)
+	prompt.feed([]byte("ls\x1b[5;1R"))
+	assert.Equal(t, "ls", prompt.buf.Text())
+	assert.False(t, prompt.renderer.cprPending)
+	assert.Equal(t, 3, prompt.renderer.promptRow)
+
+	// The request is repeated after the timeout, but not forever.
+	prompt.renderer.promptRow = -1
+	for i := 0; i < maxCPRUnanswered; i++ {
+		buffer.Reset()
+		prompt.renderer.requestPromptRow(prompt.cursor)
+		assert.Equal(t, "\x1b[6n", buffer.String())
+		prompt.renderer.requestPromptRow(prompt.cursor)
+		assert.Equal(t, "\x1b[6n", buffer.String(), "the response is awaited")
+		prompt.renderer.cprTime = time.Now().Add(-cprTimeout)
+	}
+	buffer.Reset()
+	prompt.renderer.requestPromptRow(prompt.cursor)
+	assert.Empty(t, buffer.String())
+	assert.False(t, prompt.renderer.cprPending)
 }
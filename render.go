@@ -1,12 +1,28 @@
 package prompt
 
 import (
+	"fmt"
 	"runtime"
+	"strings"
+	"time"
 
 	runewidth "github.com/mattn/go-runewidth"
 	"github.com/tarantool/go-prompt/internal/debug"
 )
 
+const (
+	// cprTimeout is the time to wait for the cursor position report
+	// before the request is repeated.
+	cprTimeout = time.Second
+	// maxCPRUnanswered is the number of the timed out cursor position
+	// requests, after which the terminal is considered not answering them.
+	maxCPRUnanswered = 3
+)
+
+// documentationMinWidth is the min width of the documentation panel
+// to the right of the completion menu.
+const documentationMinWidth = 20
+
 const (
 	// basicRenderEvent renders context and completion.
 	basicRenderEvent = iota
@@ -40,6 +56,53 @@ type Render struct {
 	selectedDescriptionBGColor   Color
 	scrollbarThumbColor          Color
 	scrollbarBGColor             Color
+	searchMatchTextColor         Color
+	searchMatchBGColor           Color
+	suggestionMatchTextColor     Color
+	groupHeaderTextColor         Color
+	groupHeaderBGColor           Color
+	autoSuggestionTextColor      Color
+	documentationTextColor       Color
+	documentationBGColor         Color
+
+	// documentationWidth is the max width of the documentation panel.
+	documentationWidth int
+	// completionPosition is true if the number of the selected suggestion
+	// and the number of the suggestions are shown in the scrollbar area
+	// of the menu.
+	completionPosition bool
+	// completionPlacement is the placement of the completion menu.
+	completionPlacement CompletionPlacement
+	// adaptiveHeight is true if the height of the completion menu is
+	// adapted to the free rows, but it is at most maxAdaptiveHeight
+	// if it is not 0.
+	adaptiveHeight    bool
+	maxAdaptiveHeight int
+	// promptRow is the row of the terminal with the beginning of
+	// the input, -1 if it is unknown.
+	promptRow int
+	// cprPending is true if the cursor position is requested, cprCursorRow
+	// is the row of the cursor in the input at the moment of the request
+	// and cprTime is the moment of the request.
+	cprPending   bool
+	cprCursorRow int
+	cprTime      time.Time
+	// cprUnanswered is the number of the timed out requests in a row.
+	cprUnanswered int
+	// aboveLines is the number of the lines rendered above the input.
+	aboveLines int
+	// reservedAbove is the number of the lines directly above the input,
+	// which are reserved for rendering and do not contain the previous
+	// output of the terminal.
+	reservedAbove int
+	// aboveWanted is the number of the lines above the input requested by
+	// the render, aboveDenied is true if the lines above the input must not
+	// be used.
+	aboveWanted int
+	aboveDenied bool
+	// movedDown is the number of the rows the input is moved down by
+	// the reservation in the current render.
+	movedDown int
 }
 
 // Setup to initialize console output.
@@ -70,6 +133,179 @@ func (r *Render) prepareArea(lines int) {
 func (r *Render) UpdateWinSize(ws *WinSize) {
 	r.row = ws.Row
 	r.col = ws.Col
+	// The lines are wrapped again.
+	r.promptRow = -1
+	r.reservedAbove = 0
+}
+
+// needsPromptRow returns true if the row of the input in the terminal is
+// used to place the completion menu.
+func (r *Render) needsPromptRow() bool {
+	return r.completionPlacement != CompletionPlacementBelow || r.adaptiveHeight
+}
+
+// requestPromptRow asks the terminal for the cursor position to find the row
+// of the input, if it is needed and unknown. The cursor is at the location
+// in the input.
+func (r *Render) requestPromptRow(cursor location) {
+	if !r.needsPromptRow() || r.promptRow >= 0 || r.cprUnanswered >= maxCPRUnanswered {
+		return
+	}
+	if r.cprPending {
+		if time.Since(r.cprTime) < cprTimeout {
+			return
+		}
+		r.cprPending = false
+		if r.cprUnanswered++; r.cprUnanswered >= maxCPRUnanswered {
+			// The terminal does not answer, the menu is placed below.
+			return
+		}
+	}
+	r.cprPending = true
+	r.cprCursorRow = cursor.row
+	r.cprTime = time.Now()
+	r.out.AskForCPR()
+	debug.AssertNoError(r.out.Flush())
+}
+
+// setCursorRow sets the row of the input by the row of the cursor in
+// the terminal from the cursor position report starting from 1.
+func (r *Render) setCursorRow(row int) {
+	r.cprPending = false
+	r.cprUnanswered = 0
+	r.promptRow = row - 1 - r.cprCursorRow
+	if r.promptRow < 0 {
+		r.promptRow = -1
+	}
+}
+
+// scrolled updates the row of the input after rendering of the lines below
+// the beginning of the input, the terminal is scrolled if they do not fit.
+func (r *Render) scrolled(lines int) {
+	if r.promptRow < 0 {
+		return
+	}
+	if overflow := r.promptRow + lines - (int(r.row) - 1); overflow > 0 {
+		r.promptRow -= overflow
+		if r.promptRow < 0 {
+			r.promptRow = 0
+		}
+	}
+}
+
+// renderedAbove records that the lines above the input are rendered.
+func (r *Render) renderedAbove(lines int) {
+	if lines > r.aboveLines {
+		r.aboveLines = lines
+	}
+}
+
+// useAbove returns true if the lines above the input are reserved and may be
+// rendered. Otherwise, the lines are requested to be reserved and they must
+// not be rendered to keep the previous output of the terminal.
+func (r *Render) useAbove(lines int) bool {
+	if lines <= minInt(r.reservedAbove, r.promptRow) {
+		r.renderedAbove(lines)
+		return true
+	}
+	if lines > r.aboveWanted {
+		r.aboveWanted = lines
+	}
+	return false
+}
+
+// reserveAbove reserves the lines requested by the render above the input.
+// The input is moved down and the terminal is scrolled if it is needed,
+// so the previous output is not overwritten. The cursor must be at
+// the beginning of the input.
+func (r *Render) reserveAbove() {
+	r.reservedAbove = minInt(r.reservedAbove, r.promptRow)
+	n := r.aboveWanted - r.reservedAbove
+	r.out.EraseDown()
+	for i := 0; i < n; i++ {
+		r.out.ScrollDown()
+	}
+	r.reservedAbove += n
+	row := minInt(r.promptRow+n, int(r.row)-1)
+	r.movedDown += row - r.promptRow
+	r.promptRow = row
+}
+
+// rowsAbove returns the number of the rows above the input. The rows
+// reserved in the current render are not counted, so the menu does not
+// grow and need more rows.
+func (r *Render) rowsAbove() int {
+	return r.promptRow - r.movedDown
+}
+
+// clearAbove erases the lines rendered above the input, the cursor must be
+// at the beginning of the input.
+func (r *Render) clearAbove() {
+	if r.aboveLines == 0 {
+		return
+	}
+	r.out.CursorUp(r.aboveLines)
+	for i := 0; i < r.aboveLines; i++ {
+		r.out.EraseLine()
+		r.out.CursorDown(1)
+	}
+	r.aboveLines = 0
+}
+
+// moveRows moves the cursor down by n rows, up if n is negative.
+func (r *Render) moveRows(n int) {
+	if n > 0 {
+		r.out.CursorDown(n)
+	} else if n < 0 {
+		r.out.CursorUp(-n)
+	}
+}
+
+// placeCompletion chooses the placement of the completion menu with
+// the rows. It returns true if the menu is
+// placed above the input and the number of the visible rows. The height of
+// the menu is adapted to the free rows of the terminal, if it is enabled.
+func (r *Render) placeCompletion(ctx renderCtx, rows int) (above bool, height int) {
+	c := ctx.completion
+	if r.promptRow < 0 || !r.needsPromptRow() {
+		c.setHeight(0)
+		return false, minInt(rows, c.visibleRows())
+	}
+	_, cursorRow := r.toPos(runewidth.StringWidth(ctx.cmd.Document().TextBeforeCursor()))
+	freeAbove := r.rowsAbove()
+	freeBelow := int(r.row) - 1 - (r.promptRow + cursorRow)
+
+	limit := int(c.max)
+	if r.adaptiveHeight {
+		limit = r.maxAdaptiveHeight
+		if limit == 0 {
+			limit = rows
+		}
+	}
+	switch {
+	case r.aboveDenied:
+	case r.completionPlacement == CompletionPlacementAbove:
+		above = freeAbove > 0
+	case r.completionPlacement == CompletionPlacementAuto:
+		above = minInt(rows, limit) > freeBelow && freeAbove > freeBelow
+	}
+
+	capacity := limit
+	if above {
+		capacity = minInt(capacity, freeAbove)
+	} else if r.adaptiveHeight {
+		if freeBelow > 0 {
+			capacity = minInt(capacity, freeBelow)
+		} else {
+			// There are no free rows, the terminal is scrolled.
+			capacity = minInt(capacity, int(c.max))
+		}
+	}
+	if capacity < 1 && rows > 0 {
+		capacity = 1
+	}
+	c.setHeight(capacity)
+	return above, minInt(rows, capacity)
 }
 
 func (r *Render) renderWindowTooSmall() {
@@ -81,33 +317,68 @@ func (r *Render) renderWindowTooSmall() {
 
 // renderCompletion renders completion.
 func (r *Render) renderCompletion(ctx renderCtx) {
+	if ctx.completion.closed {
+		return
+	}
+	position := ""
+	if c := ctx.completion; c.loading && c.loadingIndicator != "" {
+		// Show the indicator instead of the outdated suggestions.
+		ctx.completion = &CompletionManager{
+			selected: -1,
+			max:      1,
+			tmp:      []Suggest{{Text: c.loadingIndicator}},
+		}
+	} else if r.completionPosition {
+		selected, total := c.Position()
+		position = fmt.Sprintf("%d/%d", selected, total)
+	}
 	suggestions := ctx.completion.GetSuggestions()
 	if len(suggestions) == 0 {
 		return
 	}
+	if ctx.completion.grid {
+		r.renderCompletionGrid(ctx, position)
+		return
+	}
+	// The rows include the group headers.
+	rows, items := ctx.completion.menuRows()
 	prefix := ctx.prefix
 	formatted, width := formatSuggestions(
-		suggestions,
+		rows,
 		int(r.col)-runewidth.StringWidth(prefix)-1, // -1 means a width of scrollbar
 	)
 	// +1 means a width of scrollbar.
 	width++
 
-	windowHeight := len(formatted)
-	if windowHeight > int(ctx.completion.max) {
-		windowHeight = int(ctx.completion.max)
+	if len(formatted) == 0 {
+		// The terminal is too narrow for the suggestions.
+		return
+	}
+	above, windowHeight := r.placeCompletion(ctx, len(formatted))
+	windowHeight = minInt(windowHeight, len(formatted)-ctx.completion.verticalScroll)
+	if windowHeight <= 0 {
+		return
 	}
+	menuHeight := windowHeight
 	formatted = formatted[ctx.completion.verticalScroll : ctx.completion.verticalScroll+
 		windowHeight]
-	r.prepareArea(windowHeight)
 
 	cursor := runewidth.StringWidth(ctx.cmd.Document().TextBeforeCursor())
-	x, _ := r.toPos(cursor)
+	x, cursorRow := r.toPos(cursor)
+	if above {
+		if !r.useAbove(menuHeight) {
+			return
+		}
+		r.out.CursorUp(cursorRow + menuHeight)
+	} else {
+		r.prepareArea(menuHeight)
+		r.scrolled(cursorRow + menuHeight)
+	}
 	if x+width >= int(r.col) {
 		cursor = r.backward(cursor, x+width-int(r.col))
 	}
 
-	contentHeight := len(ctx.completion.tmp)
+	contentHeight := len(rows)
 
 	fractionVisible := float64(windowHeight) / float64(contentHeight)
 	fractionAbove := float64(ctx.completion.verticalScroll) / float64(contentHeight)
@@ -119,18 +390,31 @@ func (r *Render) renderCompletion(ctx renderCtx) {
 		return scrollbarTop <= row && row <= scrollbarTop+scrollbarHeight
 	}
 
-	selected := ctx.completion.selected - ctx.completion.verticalScroll
+	selected := ctx.completion.rowOf(ctx.completion.selected) - ctx.completion.verticalScroll
 	r.out.SetColor(White, Cyan, false)
 	for i := 0; i < windowHeight; i++ {
-		r.out.CursorDown(1)
+		if i > 0 || !above {
+			r.out.CursorDown(1)
+		}
+		index := items[ctx.completion.verticalScroll+i]
+		textColor, bgColor, bold := r.suggestionTextColor, r.suggestionBGColor, false
 		if i == selected {
-			r.out.SetColor(r.selectedSuggestionTextColor, r.selectedSuggestionBGColor, true)
+			textColor, bgColor = r.selectedSuggestionTextColor, r.selectedSuggestionBGColor
+			bold = true
+		} else if index == -1 {
+			textColor, bgColor, bold = r.groupHeaderTextColor, r.groupHeaderBGColor, true
+		}
+		r.out.SetColor(textColor, bgColor, bold)
+		if matches := ctx.completion.matches; matches != nil && index != -1 {
+			writeWithMatches(r.out, formatted[i].Text, suggestions[index].label(),
+				matches[index], textColor, r.suggestionMatchTextColor, bgColor, bold)
 		} else {
-			r.out.SetColor(r.suggestionTextColor, r.suggestionBGColor, false)
+			r.out.WriteStr(formatted[i].Text)
 		}
-		r.out.WriteStr(formatted[i].Text)
 
-		if i == selected {
+		if index == -1 {
+			r.out.SetColor(r.groupHeaderTextColor, r.groupHeaderBGColor, false)
+		} else if i == selected {
 			r.out.SetColor(r.selectedDescriptionTextColor, r.selectedDescriptionBGColor, false)
 		} else {
 			r.out.SetColor(r.descriptionTextColor, r.descriptionBGColor, false)
@@ -144,6 +428,9 @@ func (r *Render) renderCompletion(ctx renderCtx) {
 		}
 		r.out.WriteStr(" ")
 		r.out.SetColor(DefaultColor, DefaultColor, false)
+		if position != "" && i == windowHeight-1 {
+			r.writePosition(position, width)
+		}
 
 		r.lineWrap(cursor + width)
 		r.backward(cursor+width, width)
@@ -153,14 +440,315 @@ func (r *Render) renderCompletion(ctx renderCtx) {
 		r.out.CursorForward(x + width - int(r.col))
 	}
 
-	r.out.CursorUp(windowHeight)
+	if above {
+		r.out.CursorDown(cursorRow + 1)
+	} else {
+		r.out.CursorUp(menuHeight)
+	}
+	r.out.SetColor(DefaultColor, DefaultColor, false)
+}
+
+// writePosition writes the position in the suggestions over the right side
+// of the menu row of the width, so it ends in the scrollbar. The cursor must
+// be after the row.
+func (r *Render) writePosition(position string, width int) {
+	position = runewidth.Truncate(position, width, "")
+	r.out.CursorBackward(runewidth.StringWidth(position))
+	r.out.SetColor(r.suggestionTextColor, r.scrollbarBGColor, false)
+	r.out.WriteStr(position)
 	r.out.SetColor(DefaultColor, DefaultColor, false)
 }
 
+// renderCompletionGrid renders completion as a grid, which starts
+// at the beginning of the line below the cursor. The position is shown
+// in the bottom right corner of the grid, if it is not empty.
+func (r *Render) renderCompletionGrid(ctx renderCtx, position string) {
+	c := ctx.completion
+	cells, columns := gridLayout(c.tmp, int(r.col))
+	if columns == 0 {
+		return
+	}
+	cellWidth := runewidth.StringWidth(cells[0])
+	// +1 means a width of scrollbar.
+	width := columns*cellWidth + 1
+
+	rows := (len(cells) + columns - 1) / columns
+	above, windowHeight := r.placeCompletion(ctx, rows)
+	menuHeight := windowHeight
+
+	cursor := runewidth.StringWidth(ctx.cmd.Document().TextBeforeCursor())
+	x, cursorRow := r.toPos(cursor)
+	if above {
+		if !r.useAbove(menuHeight) {
+			return
+		}
+		r.out.CursorUp(cursorRow + menuHeight)
+	} else {
+		r.prepareArea(menuHeight)
+		r.scrolled(cursorRow + menuHeight)
+	}
+	r.out.CursorBackward(x)
+
+	fractionVisible := float64(windowHeight) / float64(rows)
+	fractionAbove := float64(c.verticalScroll) / float64(rows)
+	scrollbarHeight := int(clamp(float64(windowHeight), 1, float64(windowHeight)*fractionVisible))
+	scrollbarTop := int(float64(windowHeight) * fractionAbove)
+
+	for i := 0; i < windowHeight; i++ {
+		if i > 0 || !above {
+			r.out.CursorDown(1)
+		}
+		for j := 0; j < columns; j++ {
+			index := (c.verticalScroll+i)*columns + j
+			if index >= len(cells) {
+				r.out.SetColor(DefaultColor, DefaultColor, false)
+				r.out.WriteStr(strings.Repeat(" ", (columns-j)*cellWidth))
+				break
+			}
+			textColor, bgColor, bold := r.suggestionTextColor, r.suggestionBGColor, false
+			if index == c.selected {
+				textColor, bgColor = r.selectedSuggestionTextColor, r.selectedSuggestionBGColor
+				bold = true
+			}
+			r.out.SetColor(textColor, bgColor, bold)
+			if c.matches != nil {
+				writeWithMatches(r.out, cells[index], c.tmp[index].label(),
+					c.matches[index], textColor, r.suggestionMatchTextColor, bgColor, bold)
+			} else {
+				r.out.WriteStr(cells[index])
+			}
+		}
+
+		if scrollbarTop <= i && i <= scrollbarTop+scrollbarHeight {
+			r.out.SetColor(DefaultColor, r.scrollbarThumbColor, false)
+		} else {
+			r.out.SetColor(DefaultColor, r.scrollbarBGColor, false)
+		}
+		r.out.WriteStr(" ")
+		r.out.SetColor(DefaultColor, DefaultColor, false)
+		if position != "" && i == windowHeight-1 {
+			r.writePosition(position, width)
+		}
+		r.out.CursorBackward(width)
+	}
+
+	if above {
+		r.out.CursorDown(cursorRow + 1)
+	} else {
+		r.out.CursorUp(menuHeight)
+	}
+	r.out.CursorForward(x)
+	r.out.SetColor(DefaultColor, DefaultColor, false)
+}
+
+// completionBox returns the column, the width and the height of
+// the completion menu rendered by renderCompletion and true if it is placed
+// above the input.
+func (r *Render) completionBox(ctx renderCtx) (x, width, height int, above bool) {
+	c := ctx.completion
+	if c.closed {
+		return 0, 0, 0, false
+	}
+	if c.grid {
+		cells, columns := gridLayout(c.tmp, int(r.col))
+		if columns == 0 {
+			return 0, 0, 0, false
+		}
+		above, height = r.placeCompletion(ctx, (len(cells)+columns-1)/columns)
+		// +1 means a width of scrollbar.
+		return 0, columns*runewidth.StringWidth(cells[0]) + 1, height, above
+	}
+
+	rows, _ := c.menuRows()
+	formatted, width := formatSuggestions(rows, int(r.col)-runewidth.StringWidth(ctx.prefix)-1)
+	if width == 0 {
+		return 0, 0, 0, false
+	}
+	// +1 means a width of scrollbar.
+	width++
+	above, height = r.placeCompletion(ctx, len(formatted))
+	x, _ = r.toPos(runewidth.StringWidth(ctx.cmd.Document().TextBeforeCursor()))
+	if x+width >= int(r.col) {
+		x = int(r.col) - width
+	}
+	return x, width, height, above
+}
+
+// renderDocumentation renders the documentation of the selected suggestion
+// in a bordered panel beside the completion menu. If there is not enough
+// space, the panel is rendered under the menu or over it if the menu is
+// placed above the input.
+func (r *Render) renderDocumentation(ctx renderCtx) {
+	c := ctx.completion
+	if ctx.documentation == "" || ctx.skipPreview || (c.loading && c.loadingIndicator != "") {
+		return
+	}
+	menuX, menuWidth, menuHeight, above := r.completionBox(ctx)
+	if menuWidth == 0 {
+		return
+	}
+
+	// The panel is separated from the menu by a space, the last column
+	// is not used to prevent a line wrap.
+	x := menuX + menuWidth + 1
+	width := int(r.col) - x - 1
+	if width > r.documentationWidth {
+		width = r.documentationWidth
+	}
+	beside := width >= documentationMinWidth
+	if !beside {
+		x = 0
+		width = int(r.col) - 1
+		if width > r.documentationWidth {
+			width = r.documentationWidth
+		}
+	}
+	// The borders and the padding take 4 columns.
+	innerWidth := width - 4
+	if innerWidth < 1 {
+		return
+	}
+
+	maxHeight := c.visibleRows()
+	if above {
+		// The borders take 2 rows.
+		free := r.rowsAbove() - 2
+		if !beside {
+			free -= menuHeight
+		}
+		maxHeight = minInt(maxHeight, free)
+		if maxHeight < 1 {
+			return
+		}
+	}
+	lines := wrapText(ctx.documentation, innerWidth)
+	innerHeight := minInt(len(lines), maxHeight)
+	// Keep the scroll in the bounds for the next scrolling.
+	if maxScroll := len(lines) - innerHeight; c.docScroll > maxScroll {
+		c.docScroll = maxScroll
+	}
+
+	bottom := strings.Repeat("─", width-2)
+	if len(lines) > innerHeight {
+		position := fmt.Sprintf(" %d/%d ", c.docScroll+innerHeight, len(lines))
+		if n := width - 2 - runewidth.StringWidth(position); n > 0 {
+			bottom = strings.Repeat("─", n) + position
+		}
+	}
+	panel := make([]string, 0, innerHeight+2)
+	panel = append(panel, "┌"+strings.Repeat("─", width-2)+"┐")
+	for _, line := range lines[c.docScroll : c.docScroll+innerHeight] {
+		panel = append(panel, "│ "+runewidth.FillRight(line, innerWidth)+" │")
+	}
+	panel = append(panel, "└"+bottom+"┘")
+
+	// top is the row of the first line of the panel relative to the cursor.
+	cursorX, cursorRow := r.toPos(runewidth.StringWidth(ctx.cmd.Document().TextBeforeCursor()))
+	top := 1
+	switch {
+	case above && beside:
+		top = -cursorRow - len(panel)
+	case above:
+		top = -cursorRow - menuHeight - len(panel)
+	case !beside:
+		top = menuHeight + 1
+	}
+	if above {
+		if !r.useAbove(-top - cursorRow) {
+			return
+		}
+	} else {
+		r.prepareArea(top + len(panel) - 1)
+		r.scrolled(cursorRow + top + len(panel) - 1)
+	}
+
+	r.moveRows(top)
+	r.out.CursorBackward(cursorX)
+	for i, line := range panel {
+		if i > 0 {
+			r.out.CursorDown(1)
+		}
+		r.out.CursorForward(x)
+		r.out.SetColor(r.documentationTextColor, r.documentationBGColor, false)
+		r.out.WriteStr(line)
+		r.out.SetColor(DefaultColor, DefaultColor, false)
+		r.out.CursorBackward(x + width)
+	}
+	r.moveRows(-(top + len(panel) - 1))
+	r.out.CursorForward(cursorX)
+}
+
+// wrapText wraps the lines of the text to the width breaking them
+// at spaces if it is possible.
+func wrapText(text string, width int) []string {
+	text = strings.Replace(text, "\t", "    ", -1)
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		for runewidth.StringWidth(line) > width {
+			cut := runewidth.Truncate(line, width, "")
+			if i := strings.LastIndex(cut, " "); i > 0 {
+				cut = cut[:i]
+			} else if cut == "" {
+				// The first rune is wider than the width.
+				cut = string([]rune(line)[:1])
+			}
+			lines = append(lines, cut)
+			line = strings.TrimLeft(line[len(cut):], " ")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// writeWithMatches writes the formatted suggestion text to the out, the runes
+// of the original text at the matched positions are written with the match color.
+// Runes cut off by the formatting are not highlighted.
+func writeWithMatches(
+	out ConsoleWriter,
+	formatted string,
+	text string,
+	matches []int,
+	textColor Color,
+	matchColor Color,
+	bgColor Color,
+	bold bool,
+) {
+	formattedRunes := []rune(formatted)
+	textRunes := []rune(text)
+	offset := len([]rune(leftPrefix))
+
+	start := 0
+	for _, pos := range matches {
+		i := offset + pos
+		if pos >= len(textRunes) || i >= len(formattedRunes) ||
+			formattedRunes[i] != textRunes[pos] {
+			continue
+		}
+		out.WriteStr(string(formattedRunes[start:i]))
+		out.SetColor(matchColor, bgColor, true)
+		out.WriteStr(string(formattedRunes[i]))
+		out.SetColor(textColor, bgColor, bold)
+		start = i + 1
+	}
+	out.WriteStr(string(formattedRunes[start:]))
+}
+
+// renderMessage writes the message lines at the current position,
+// which must be the beginning of a line.
+func (r *Render) renderMessage(msg string) {
+	defer func() { debug.AssertNoError(r.out.Flush()) }()
+	r.out.SetColor(DefaultColor, DefaultColor, false)
+	r.out.WriteStr(msg + "\n")
+}
+
 // ClearScreen clears the screen and moves the cursor to home.
 func (r *Render) ClearScreen() {
 	r.out.EraseScreen()
 	r.out.CursorGoTo(0, 0)
+	r.promptRow = 0
+	r.aboveLines = 0
+	r.reservedAbove = 0
 }
 
 // writeCmdWithPrefix writes cmd with prefix to the out.
@@ -178,6 +766,46 @@ func writeCmdWithPrefix(
 	out.WriteStr(cmd[prefixLen:])
 }
 
+// writeCmdWithHighlight writes cmd with prefix to the out like
+// writeCmdWithPrefix, the bytes range [start, end) of cmd after
+// the prefix is written with the highlight colors.
+func writeCmdWithHighlight(
+	out ConsoleWriter,
+	cmd string,
+	prefixLen int,
+	start int,
+	end int,
+	prefixColor Color,
+	bgColor Color,
+	highlightColor Color,
+	highlightBGColor Color,
+) {
+	writeCmdWithPrefix(out, cmd[:start], prefixLen, prefixColor, bgColor, DefaultColor)
+	out.SetColor(highlightColor, highlightBGColor, false)
+	out.WriteStr(cmd[start:end])
+	out.SetColor(DefaultColor, DefaultColor, false)
+	out.WriteStr(cmd[end:])
+}
+
+// splitLinesRange converts the runes range in the text to the range
+// in the split text, which differs from the text by extra line breaks only.
+func splitLinesRange(text, split []rune, rng textRange) textRange {
+	if rng.start < 0 || rng.end > len(text) || rng.start >= rng.end {
+		return textRange{}
+	}
+	// positions[i] is the position of the i-th text rune in the split text.
+	positions := make([]int, 0, len(text))
+	for i := 0; i < len(split) && len(positions) < len(text); i++ {
+		if split[i] == text[len(positions)] {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) < len(text) {
+		return textRange{}
+	}
+	return textRange{start: positions[rng.start], end: positions[rng.end-1] + 1}
+}
+
 // preprocessCtx preprocesses the context before rendering.
 func (r *Render) preprocessCtx(ctx renderCtx) renderCtx {
 	ctx.cmd = ctx.cmd.SplitWideLines(int(r.col))
@@ -188,6 +816,7 @@ func (r *Render) preprocessCtx(ctx renderCtx) renderCtx {
 // (new location of cursor, new location of the end of the rendered command).
 func (r *Render) renderCtx(ctx renderCtx) (newCursor location, newEndCursor location) {
 	// Preprocess the context.
+	text := ctx.cmd.Text()
 	ctx = r.preprocessCtx(ctx)
 
 	// Calculate current cursor position.
@@ -208,11 +837,28 @@ func (r *Render) renderCtx(ctx renderCtx) (newCursor location, newEndCursor loca
 		// Erase rendered recently.
 		r.clear(ctxEndCursorPos, false)
 	}
+	r.clearAbove()
 
 	// Render.
-	writeCmdWithPrefix(r.out, ctx.cmd.Text(), len(ctx.prefix),
-		ctx.prefixColor, r.prefixBGColor, DefaultColor)
+	if ctx.highlight.start < ctx.highlight.end {
+		split := []rune(ctx.cmd.Text())
+		highlight := splitLinesRange([]rune(text), split, ctx.highlight)
+		start := len(string(split[:highlight.start]))
+		end := len(string(split[:highlight.end]))
+		if start < len(ctx.prefix) {
+			start = len(ctx.prefix)
+		}
+		if end < start {
+			end = start
+		}
+		writeCmdWithHighlight(r.out, ctx.cmd.Text(), len(ctx.prefix), start, end,
+			ctx.prefixColor, r.prefixBGColor, r.searchMatchTextColor, r.searchMatchBGColor)
+	} else {
+		writeCmdWithPrefix(r.out, ctx.cmd.Text(), len(ctx.prefix),
+			ctx.prefixColor, r.prefixBGColor, DefaultColor)
+	}
 	r.lineWrap(endCol)
+	r.scrolled(endRow)
 
 	// Move cursor back to the position inside cmd.
 	r.move(endRow*int(r.col)+endCol, cursorRow*int(r.col)+cursorCol)
@@ -241,23 +887,59 @@ func (r *Render) Render(ctx renderCtx) (location, location) {
 	}()
 
 	// Render current state.
-	curCursor, endCursor := r.renderCtx(ctx)
+	var curCursor, endCursor location
+	r.aboveDenied, r.movedDown = false, 0
+	for reserved := false; ; reserved = true {
+		curCursor, endCursor = r.renderCtx(ctx)
+		r.renderAutoSuggestion(ctx, curCursor)
+		if !ctx.renderCompletion {
+			break
+		}
+		r.aboveWanted = 0
+		r.renderCompletion(ctx)
+		r.renderDocumentation(ctx)
+		if r.aboveWanted == 0 {
+			break
+		}
+		// The lines above the input are reserved and everything is rendered
+		// again. The menu is rendered below if it does not help.
+		r.move(curCursor.row*int(r.col)+curCursor.col, 0)
+		if !reserved {
+			r.reserveAbove()
+		} else {
+			r.aboveDenied = true
+		}
+		ctx.cursor, ctx.endCursor = location{}, location{}
+	}
 
 	if ctx.renderCompletion {
-		r.renderCompletion(ctx)
-		if suggest, ok := ctx.completion.GetSelectedSuggestion(); ok {
-			curCursor.col = r.backward(curCursor.col, runewidth.StringWidth(
-				ctx.cmd.Document().GetWordBeforeCursorUntilSeparator(
-					ctx.completion.wordSeparator,
-				),
-			))
+		if suggest, ok := ctx.completion.GetSelectedSuggestion(); ok && !ctx.skipPreview {
+			input := ctx.input
+			if input == nil {
+				input = ctx.cmd.Document()
+			}
+			before, after := ctx.completion.replaceRange(suggest, input)
+			beforeRunes := []rune(input.TextBeforeCursor())
+			afterRunes := []rune(input.TextAfterCursor())
+			replaced := runewidth.StringWidth(string(beforeRunes[len(beforeRunes)-before:]))
+			curCursor.col = r.backward(curCursor.col, replaced)
 
+			text := suggest.insertText()
+			if suggest.Replace == nil {
+				text = ctx.completion.quote(text, input, true)
+			}
 			r.out.SetColor(r.previewSuggestionTextColor, r.previewSuggestionBGColor, false)
-			r.out.WriteStr(suggest.Text)
+			r.out.WriteStr(text)
 			r.out.SetColor(DefaultColor, DefaultColor, false)
-			curCursor.col += runewidth.StringWidth(suggest.Text)
+			curCursor.col += runewidth.StringWidth(text)
 
-			rest := ctx.cmd.Document().TextAfterCursor()
+			rest := string(afterRunes[after:])
+			// Cover the rest of the replaced text.
+			padding := replaced + runewidth.StringWidth(string(afterRunes)) -
+				runewidth.StringWidth(text) - runewidth.StringWidth(rest)
+			if padding > 0 {
+				rest += strings.Repeat(" ", padding)
+			}
 			r.out.WriteStr(rest)
 			curCursor.col += runewidth.StringWidth(rest)
 			r.lineWrap(curCursor.col)
@@ -269,6 +951,20 @@ func (r *Render) Render(ctx renderCtx) (location, location) {
 	return curCursor, endCursor
 }
 
+// renderAutoSuggestion renders the auto-suggestion after the cursor.
+// It is truncated to the end of the line to keep the layout.
+func (r *Render) renderAutoSuggestion(ctx renderCtx, cursor location) {
+	// -1 prevents a line wrap.
+	text := runewidth.Truncate(ctx.autoSuggestion, int(r.col)-cursor.col-1, "")
+	if text == "" {
+		return
+	}
+	r.out.SetColor(r.autoSuggestionTextColor, DefaultColor, false)
+	r.out.WriteStr(text)
+	r.out.SetColor(DefaultColor, DefaultColor, false)
+	r.out.CursorBackward(runewidth.StringWidth(text))
+}
+
 // renderBreakline renders state with linebreak and calls breakline callback.
 func (r *Render) renderBreakLine(ctx renderCtx) (location, location) {
 	defer func() { debug.AssertNoError(r.out.Flush()) }()
@@ -287,6 +983,9 @@ func (r *Render) renderBreakLine(ctx renderCtx) (location, location) {
 
 	// Render state.
 	r.renderCtx(ctx)
+	// The next input starts after the output of the command.
+	r.promptRow = -1
+	r.reservedAbove = 0
 
 	if r.breakLineCallback != nil {
 		r.breakLineCallback(cmdDocument)
@@ -348,6 +1047,14 @@ func (r *Render) lineWrap(cursor int) {
 	}
 }
 
+// minInt returns the minimum of the integers.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func clamp(high, low, x float64) float64 {
 	switch {
 	case high < x:
@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"io"
 	"reflect"
+	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -165,3 +167,449 @@ func TestWriteCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteCmdWithHighlight(t *testing.T) {
+	buffer := bytes.Buffer{}
+	consoleWriter := &mockConsoleWriter{w: &buffer}
+
+	cmd := "prefix> строка\nline"
+	writeCmdWithHighlight(consoleWriter, cmd, 7, len("prefix> с"), len("prefix> строка\nli"),
+		DarkBlue, DefaultColor, Black, Yellow)
+	consoleWriter.Flush()
+	assert.Equal(t, "\x1b[0;34;49mprefix>\x1b[0;39;49m с"+
+		"\x1b[0;30;103mтрока\nli\x1b[0;39;49mne", buffer.String())
+}
+
+func TestSplitLinesRange(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		maxWidth int
+		rng      textRange
+		expected textRange
+	}{
+		{name: "no split", text: "abc\ndef", maxWidth: 10,
+			rng: textRange{2, 5}, expected: textRange{2, 5}},
+		{name: "after split", text: "abcdef\ngh", maxWidth: 4,
+			rng: textRange{4, 8}, expected: textRange{5, 9}},
+		{name: "over split", text: "abcdef\ngh", maxWidth: 2,
+			rng: textRange{1, 4}, expected: textRange{1, 5}},
+		{name: "split at end", text: "abcdef", maxWidth: 3,
+			rng: textRange{0, 3}, expected: textRange{0, 3}},
+		{name: "empty", text: "abc", maxWidth: 3,
+			rng: textRange{1, 1}, expected: textRange{}},
+		{name: "out of range", text: "abc", maxWidth: 3,
+			rng: textRange{1, 5}, expected: textRange{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBuffer()
+			b.InsertText(tc.text, false, true)
+			split := b.SplitWideLines(tc.maxWidth).Text()
+			assert.Equal(t, tc.expected, splitLinesRange([]rune(tc.text), []rune(split), tc.rng))
+		})
+	}
+}
+
+func TestWriteWithMatches(t *testing.T) {
+	buffer := bytes.Buffer{}
+	consoleWriter := &mockConsoleWriter{w: &buffer}
+
+	// The last match is cut off by the formatting.
+	writeWithMatches(consoleWriter, " бокс.i... ", "бокс.info", []int{1, 4, 8},
+		White, DarkRed, Cyan, false)
+	consoleWriter.Flush()
+	assert.Equal(t, " б\x1b[1;31;46mо\x1b[0;97;46mкс\x1b[1;31;46m.\x1b[0;97;46mi... ",
+		buffer.String())
+}
+
+func TestRenderCompletionLoadingIndicator(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{out: &mockConsoleWriter{w: &buffer}, col: 80, row: 24}
+	completion := NewCompletionManager(nil, 6)
+	completion.tmp = []Suggest{{Text: "outdated"}}
+	completion.loadingIndicator = "loading..."
+	completion.loading = true
+
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	assert.Contains(t, buffer.String(), "loading...")
+	assert.NotContains(t, buffer.String(), "outdated")
+
+	buffer.Reset()
+	completion.loading = false
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	assert.Contains(t, buffer.String(), "outdated")
+}
+
+func TestRenderCompletionGrid(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{out: &mockConsoleWriter{w: &buffer}, col: 14, row: 24}
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "a"}, {Text: "b"}, {Text: "c"}, {Text: "d"}, {Text: "e"}}
+	}, 6)
+	completion.layout = CompletionLayoutGrid
+	completion.width = 14
+	completion.Update(Document{})
+	completion.Next()
+
+	cmd := NewBuffer()
+	cmd.InsertText("ab", false, true)
+	r.renderCompletionGrid(renderCtx{cmd: cmd, completion: completion}, "")
+	r.out.Flush()
+
+	out := buffer.String()
+	// The grid starts at the beginning of the line.
+	assert.True(t, strings.HasPrefix(out, "\x1bD\x1bD\x1bM\x1bM\x1b[2D\x1b[1B"), out)
+	assert.Contains(t, out, "\x1b[1;39;49m a \x1b[0;39;49m b \x1b[0;39;49m c \x1b[0;39;49m d ")
+	assert.Contains(t, out, " e \x1b[0;39;49m         ", "the last row is padded")
+	// The cursor is returned to the input.
+	assert.True(t, strings.HasSuffix(out, "\x1b[13D\x1b[2A\x1b[2C\x1b[0;39;49m"), out)
+}
+
+func TestRenderCompletionGroups(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{
+		out:                  &mockConsoleWriter{w: &buffer},
+		col:                  80,
+		row:                  24,
+		groupHeaderTextColor: White,
+		groupHeaderBGColor:   DarkGray,
+	}
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "a", Group: "functions"}, {Text: "b"}}
+	}, 6)
+	completion.Update(Document{})
+	completion.Next()
+
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+
+	// The width of the header is taken into account.
+	out := buffer.String()
+	assert.Contains(t, out, " b         ")
+	assert.Contains(t, out, "\x1b[1;97;100m functions ")
+	assert.Contains(t, out, " a         ")
+}
+
+func TestRenderAutoSuggestion(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{out: &mockConsoleWriter{w: &buffer}, col: 10, autoSuggestionTextColor: DarkGray}
+
+	r.renderAutoSuggestion(renderCtx{autoSuggestion: "info()"}, location{col: 2})
+	r.out.Flush()
+	assert.Equal(t, "\x1b[0;90;49minfo()\x1b[0;39;49m\x1b[6D", buffer.String())
+
+	// The suggestion is truncated to the end of the line.
+	buffer.Reset()
+	r.renderAutoSuggestion(renderCtx{autoSuggestion: "info()"}, location{col: 5})
+	r.out.Flush()
+	assert.Equal(t, "\x1b[0;90;49minfo\x1b[0;39;49m\x1b[4D", buffer.String())
+}
+
+func TestRenderSuggestionPreview(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{out: &mockConsoleWriter{w: &buffer}, col: 80, row: 24}
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{
+			Text:    "sp",
+			Display: "space (menu)",
+			Replace: &SuggestRange{Start: 4, End: 8},
+		}}
+	}, 6)
+	completion.Update(Document{})
+	completion.Next()
+
+	input := NewBuffer()
+	input.InsertText("box.spac + 1", false, true)
+	input.setCursorPosition(6)
+	cmd := NewBuffer()
+	cmd.InsertText("> box.spac + 1", false, true)
+	cmd.setCursorPosition(8)
+	r.Render(renderCtx{
+		cmd:              cmd,
+		input:            input.Document(),
+		completion:       completion,
+		prefix:           "> ",
+		renderCompletion: true,
+	})
+
+	out := buffer.String()
+	assert.Contains(t, out, "space (menu)")
+	// "spac" is replaced by "sp" and the rest is covered.
+	assert.Contains(t, out, "\x1b[2D\x1b[0;39;49msp\x1b[0;39;49m + 1  \x1b[6D")
+}
+
+func TestWrapText(t *testing.T) {
+	assert.Equal(t, []string{"box.info()", "returns", "info"}, wrapText("box.info() returns info", 10))
+	assert.Equal(t, []string{"abcd", "ef", "", "g"}, wrapText("abcdef\n\ng", 4))
+	assert.Equal(t, []string{"a", "    b"}, wrapText("a\n\tb", 10))
+}
+
+func TestRenderDocumentation(t *testing.T) {
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "info"}, {Text: "cfg"}}
+	}, 2)
+	completion.Update(Document{})
+	completion.Next()
+	ctx := renderCtx{
+		cmd:           NewBuffer(),
+		completion:    completion,
+		documentation: "Returns the information about the instance.\nSee the manual.",
+	}
+
+	var buffer bytes.Buffer
+	r := &Render{out: &mockConsoleWriter{w: &buffer}, col: 40, row: 24, documentationWidth: 60}
+	r.renderDocumentation(ctx)
+	r.out.Flush()
+	out := buffer.String()
+	// The panel is to the right of the menu.
+	assert.Contains(t, out, "\x1b[8C\x1b[0;39;49m┌"+strings.Repeat("─", 29)+"┐")
+	assert.Contains(t, out, "│ Returns the information     │")
+	assert.Contains(t, out, "└"+strings.Repeat("─", 24)+" 2/3 ┘", "the panel is scrollable")
+
+	completion.ScrollDocumentation(10)
+	buffer.Reset()
+	r.renderDocumentation(ctx)
+	r.out.Flush()
+	assert.Contains(t, buffer.String(), "│ about the instance.         │")
+	assert.Contains(t, buffer.String(), " 3/3 ┘")
+	assert.Equal(t, 1, completion.docScroll, "the scroll is clamped")
+
+	// There is not enough space to the right.
+	buffer.Reset()
+	r.col = 28
+	r.renderDocumentation(ctx)
+	r.out.Flush()
+	assert.Contains(t, buffer.String(), "\x1b[3B\x1b[0;39;49m┌"+strings.Repeat("─", 25)+"┐")
+}
+
+func TestRenderCompletionPosition(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{
+		out:                &mockConsoleWriter{w: &buffer},
+		col:                80,
+		row:                24,
+		completionPosition: true,
+	}
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "first"}, {Text: "second"}, {Text: "third"}}
+	}, 2)
+	completion.Update(Document{})
+	completion.Last()
+
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	out := buffer.String()
+	// The position is written over the end of the last row and the scrollbar.
+	assert.Contains(t, out,
+		" third  \x1b[0;39;49m\x1b[0;39;49m \x1b[0;39;49m\x1b[3D\x1b[0;39;49m3/3")
+	// The position does not take an extra line.
+	assert.True(t, strings.HasSuffix(out, "\x1b[2A\x1b[0;39;49m"), out)
+
+	// Nothing is rendered for the closed menu.
+	buffer.Reset()
+	completion.Cancel()
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	assert.Empty(t, buffer.String())
+}
+
+func TestRenderCompletionNarrow(t *testing.T) {
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "first"}, {Text: "second"}, {Text: "third"}}
+	}, 2)
+	completion.Update(Document{})
+	completion.Last()
+
+	for _, promptRow := range []int{-1, 0, 20} {
+		var buffer bytes.Buffer
+		r := &Render{
+			out:                 &mockConsoleWriter{w: &buffer},
+			col:                 12,
+			row:                 24,
+			promptRow:           promptRow,
+			completionPlacement: CompletionPlacementAuto,
+		}
+		ctx := renderCtx{cmd: NewBuffer(), completion: completion, prefix: "(history)`':"}
+		assert.NotPanics(t, func() { r.renderCompletion(ctx) })
+		r.out.Flush()
+		assert.Empty(t, buffer.String(), "there is no room for the menu")
+	}
+}
+
+func TestRenderCompletionAbove(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{
+		out:                 &mockConsoleWriter{w: &buffer},
+		col:                 80,
+		row:                 24,
+		promptRow:           20,
+		completionPlacement: CompletionPlacementAuto,
+	}
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "a"}, {Text: "b"}, {Text: "c"}, {Text: "d"}, {Text: "e"}}
+	}, 6)
+	completion.Update(Document{})
+	completion.Next()
+
+	// There are 3 free rows below and 20 rows above, but they are
+	// the previous output of the terminal.
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	assert.Empty(t, buffer.String())
+	assert.Equal(t, 5, r.aboveWanted)
+	assert.Equal(t, 0, r.aboveLines)
+
+	r.reservedAbove = 5
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	out := buffer.String()
+	assert.True(t, strings.HasPrefix(out, "\x1b[5A"), out)
+	assert.NotContains(t, out, "\x1bD", "the terminal is not scrolled")
+	assert.True(t, strings.HasSuffix(out, "\x1b[1B\x1b[0;39;49m"), out)
+	assert.Equal(t, 5, r.aboveLines)
+
+	// The menu fits below.
+	r.promptRow = 10
+	r.aboveLines = 0
+	buffer.Reset()
+	r.renderCompletion(renderCtx{cmd: NewBuffer(), completion: completion})
+	r.out.Flush()
+	assert.True(t, strings.HasPrefix(buffer.String(), "\x1bD"), buffer.String())
+	assert.Equal(t, 0, r.aboveLines)
+
+	// The lines above are erased by the next render.
+	r.aboveLines = 2
+	buffer.Reset()
+	r.clearAbove()
+	r.out.Flush()
+	assert.Equal(t, "\x1b[2A\x1b[2K\x1b[1B\x1b[2K\x1b[1B", buffer.String())
+	assert.Equal(t, 0, r.aboveLines)
+}
+
+func TestRenderReserveAbove(t *testing.T) {
+	var buffer bytes.Buffer
+	r := &Render{
+		out:                 &mockConsoleWriter{w: &buffer},
+		col:                 80,
+		row:                 24,
+		promptRow:           20,
+		completionPlacement: CompletionPlacementAuto,
+	}
+	completion := NewCompletionManager(func(Document) []Suggest {
+		return []Suggest{{Text: "a"}, {Text: "b"}, {Text: "c"}, {Text: "d"}, {Text: "e"}}
+	}, 6)
+	completion.Update(Document{})
+	cmd := NewBuffer()
+	cmd.InsertText("> ", false, true)
+	ctx := renderCtx{
+		cmd:              cmd,
+		prefix:           "> ",
+		completion:       completion,
+		renderCompletion: true,
+	}
+
+	// The previous output is scrolled up instead of being overwritten.
+	r.Render(ctx)
+	out := buffer.String()
+	assert.Contains(t, out, "\x1b[J\x1bD\x1bD\x1bD\x1bD\x1bD", out)
+	assert.Equal(t, 23, r.promptRow)
+	assert.Equal(t, 5, r.reservedAbove)
+	assert.Equal(t, 5, r.aboveLines)
+	assert.Contains(t, out, "\x1b[5A", "the menu is rendered above")
+
+	// The reserved lines are used again.
+	buffer.Reset()
+	r.Render(ctx)
+	assert.NotContains(t, buffer.String(), "\x1bD")
+	assert.Equal(t, 5, r.reservedAbove)
+	assert.Equal(t, 5, r.aboveLines)
+
+	// The lines are not reserved for the next input.
+	r.renderBreakLine(ctx)
+	assert.Equal(t, 0, r.reservedAbove)
+
+	// The adapted menu does not grow after the reservation.
+	r.promptRow = 5
+	r.completionPlacement = CompletionPlacementAbove
+	r.adaptiveHeight = true
+	ctx.completion = NewCompletionManager(func(Document) []Suggest {
+		suggestions := make([]Suggest, 30)
+		for i := range suggestions {
+			suggestions[i].Text = strconv.Itoa(i)
+		}
+		return suggestions
+	}, 6)
+	ctx.completion.Update(Document{})
+	buffer.Reset()
+	r.Render(ctx)
+	assert.Equal(t, 10, r.promptRow)
+	assert.Equal(t, 5, r.reservedAbove)
+	assert.Equal(t, 5, r.aboveLines)
+}
+
+func TestPlaceCompletion(t *testing.T) {
+	r := &Render{out: &mockConsoleWriter{w: &bytes.Buffer{}}, col: 80, row: 24, promptRow: -1}
+	completion := NewCompletionManager(nil, 6)
+	ctx := renderCtx{cmd: NewBuffer(), completion: completion}
+
+	// The row is not used by default.
+	above, height := r.placeCompletion(ctx, 30)
+	assert.False(t, above)
+	assert.Equal(t, 6, height)
+
+	// The row is unknown.
+	r.adaptiveHeight = true
+	above, height = r.placeCompletion(ctx, 30)
+	assert.False(t, above)
+	assert.Equal(t, 6, height)
+
+	// The free rows below the input are used.
+	r.promptRow = 2
+	above, height = r.placeCompletion(ctx, 30)
+	assert.False(t, above)
+	assert.Equal(t, 21, height)
+	assert.Equal(t, 21, completion.visibleRows())
+
+	r.maxAdaptiveHeight = 10
+	_, height = r.placeCompletion(ctx, 30)
+	assert.Equal(t, 10, height)
+
+	// Above the input there are less free rows.
+	r.completionPlacement = CompletionPlacementAbove
+	above, height = r.placeCompletion(ctx, 30)
+	assert.True(t, above)
+	assert.Equal(t, 2, height)
+
+	// The input is at the top of the terminal.
+	r.promptRow = 0
+	above, height = r.placeCompletion(ctx, 30)
+	assert.False(t, above)
+	assert.Equal(t, 10, height)
+
+	// The lines above the input cannot be reserved.
+	r.promptRow = 20
+	r.aboveDenied = true
+	above, _ = r.placeCompletion(ctx, 30)
+	assert.False(t, above)
+}
+
+func TestRenderScrolled(t *testing.T) {
+	r := &Render{row: 24, promptRow: 20}
+	r.scrolled(3)
+	assert.Equal(t, 20, r.promptRow)
+	r.scrolled(5)
+	assert.Equal(t, 18, r.promptRow)
+
+	r.promptRow = -1
+	r.scrolled(5)
+	assert.Equal(t, -1, r.promptRow)
+
+	r.cprPending, r.cprCursorRow = true, 1
+	r.setCursorRow(12)
+	assert.False(t, r.cprPending)
+	assert.Equal(t, 10, r.promptRow)
+}
@@ -1,38 +1,148 @@
 package prompt
 
 import (
+	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
-	matchSearchPrefixFmt = "(reverse-i-search)`%s':"
-	failSearchPrefixFmt  = "(failed reverse-i-search)`%s':"
+	matchSearchPrefixFmt        = "(reverse-i-search)`%s':"
+	failSearchPrefixFmt         = "(failed reverse-i-search)`%s':"
+	matchForwardSearchPrefixFmt = "(i-search)`%s':"
+	failForwardSearchPrefixFmt  = "(failed i-search)`%s':"
+	searchInfoFmt               = " [%s] "
 )
 
+// SearchPrefixFormats contains formats of the prefix shown in the incremental
+// search mode. Every format takes the search query as a single argument.
+type SearchPrefixFormats struct {
+	// Reverse is used when a backward search has a match.
+	Reverse string
+	// FailedReverse is used when a backward search has no match.
+	FailedReverse string
+	// Forward is used when a forward search has a match.
+	Forward string
+	// FailedForward is used when a forward search has no match.
+	FailedForward string
+}
+
+// defaultSearchPrefixFormats are readline-like search prefix formats.
+var defaultSearchPrefixFormats = SearchPrefixFormats{
+	Reverse:       matchSearchPrefixFmt,
+	FailedReverse: failSearchPrefixFmt,
+	Forward:       matchForwardSearchPrefixFmt,
+	FailedForward: failForwardSearchPrefixFmt,
+}
+
+// HistoryEntryInfo formats the metadata of a history entry as
+// "time, duration, status" skipping empty fields. It may be used
+// with OptionReverseSearchEntryInfo.
+func HistoryEntryInfo(entry HistoryEntry) string {
+	info := make([]string, 0, 3)
+	if !entry.Time.IsZero() {
+		info = append(info, entry.Time.Format("2006-01-02 15:04:05"))
+	}
+	if entry.Duration != 0 {
+		info = append(info, entry.Duration.Round(time.Millisecond).String())
+	}
+	if entry.Status != "" {
+		info = append(info, entry.Status)
+	}
+	return strings.Join(info, ", ")
+}
+
+// searchDirection is a direction of the incremental search in the history.
+type searchDirection int
+
+const (
+	// searchBackward searches from the newer entries to the older ones.
+	searchBackward searchDirection = iota
+	// searchForward searches from the older entries to the newer ones.
+	searchForward
+)
+
+// searchMatcher returns the bytes range of the first match in s,
+// start is -1 if there is no match.
+type searchMatcher func(s string) (start, end int)
+
+// newSearchMatcher returns a matcher for the search query.
+// An invalid regular expression matches nothing.
+func newSearchMatcher(query string, ignoreCase, useRegexp bool) searchMatcher {
+	if !ignoreCase && !useRegexp {
+		return func(s string) (int, int) {
+			start := strings.Index(s, query)
+			if start == -1 {
+				return -1, -1
+			}
+			return start, start + len(query)
+		}
+	}
+
+	if !useRegexp {
+		query = regexp.QuoteMeta(query)
+	}
+	if ignoreCase {
+		query = "(?i)" + query
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return func(string) (int, int) {
+			return -1, -1
+		}
+	}
+	return func(s string) (int, int) {
+		loc := re.FindStringIndex(s)
+		if loc == nil {
+			return -1, -1
+		}
+		return loc[0], loc[1]
+	}
+}
+
 // reverseSearchState contains info about reverseSearch state.
 type reverseSearchState struct {
 	// history, with which reverse-search works.
 	history *History
-	// searchFromIndex is the last history index, included to the search scope.
+	// direction is the current search direction.
+	direction searchDirection
+	// searchFromIndex is the history index, from which the search scope
+	// starts in the current direction.
 	searchFromIndex int
 	// matchedIndex is the index of the last matched.
 	matchedIndex int
 	// matchedCmd is the last matched command.
 	matchedCmd string
+	// matchedStart and matchedEnd are the runes range of
+	// the matched substring in matchedCmd.
+	matchedStart int
+	matchedEnd   int
+
+	// ignoreCase is true if the search is case-insensitive.
+	ignoreCase bool
+	// useRegexp is true if the search query is a regular expression.
+	useRegexp bool
+
+	// originalBuf is the buffer before the search was started.
+	originalBuf *Buffer
 }
 
 // NewReverseSearch returns new reverseSearchState instance.
 func NewReverseSearch(history *History) *reverseSearchState {
 	return &reverseSearchState{
 		history:         history,
+		direction:       searchBackward,
 		searchFromIndex: history.selected,
 		matchedIndex:    -1,
 		matchedCmd:      "",
 	}
 }
 
-// reducePrefix reduces the search scope.
+// reducePrefix reduces the search scope to the entries older than
+// the matched one, switches the search direction to backward.
 func (rs *reverseSearchState) reducePrefix() {
+	rs.direction = searchBackward
 	if rs.matchedIndex != -1 {
 		rs.searchFromIndex = rs.matchedIndex - 1
 	}
@@ -41,14 +151,50 @@ func (rs *reverseSearchState) reducePrefix() {
 	}
 }
 
+// reduceSuffix reduces the search scope to the entries newer than
+// the matched one, switches the search direction to forward.
+func (rs *reverseSearchState) reduceSuffix() {
+	rs.direction = searchForward
+	if rs.matchedIndex != -1 {
+		rs.searchFromIndex = rs.matchedIndex + 1
+	}
+	if last := len(rs.history.tmp) - 1; rs.searchFromIndex > last {
+		rs.searchFromIndex = last
+	}
+}
+
 // update updates current reverse-search state.
 func (rs *reverseSearchState) update(input string) {
-	rs.matchedIndex = rs.history.FindMatch(
-		strings.TrimSpace(input), rs.searchFromIndex,
-	)
+	match := newSearchMatcher(strings.TrimSpace(input), rs.ignoreCase, rs.useRegexp)
+	step := -1
+	if rs.direction == searchForward {
+		step = 1
+	}
+	rs.matchedIndex = rs.history.findMatch(match, rs.searchFromIndex, step)
+	rs.matchedCmd, rs.matchedStart, rs.matchedEnd = "", 0, 0
 	if rs.matchedIndex != -1 {
 		rs.matchedCmd = rs.history.tmp[rs.matchedIndex]
-	} else {
-		rs.matchedCmd = ""
+		start, end := match(rs.matchedCmd)
+		rs.matchedStart = utf8.RuneCountInString(rs.matchedCmd[:start])
+		rs.matchedEnd = rs.matchedStart + utf8.RuneCountInString(rs.matchedCmd[start:end])
+	}
+}
+
+// prefixFormat returns the format of the search prefix for the current state.
+// Empty formats are replaced with the default ones.
+func (rs *reverseSearchState) prefixFormat(formats SearchPrefixFormats) string {
+	format, defaultFormat := formats.Reverse, defaultSearchPrefixFormats.Reverse
+	failed := rs.matchedIndex == -1
+	switch {
+	case rs.direction == searchForward && failed:
+		format, defaultFormat = formats.FailedForward, defaultSearchPrefixFormats.FailedForward
+	case rs.direction == searchForward:
+		format, defaultFormat = formats.Forward, defaultSearchPrefixFormats.Forward
+	case failed:
+		format, defaultFormat = formats.FailedReverse, defaultSearchPrefixFormats.FailedReverse
+	}
+	if format == "" {
+		return defaultFormat
 	}
+	return format
 }
@@ -2,6 +2,7 @@ package prompt
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -46,3 +47,97 @@ func TestRevSearch(t *testing.T) {
 	}
 	assert.Equal(t, 0, revSearchState.searchFromIndex)
 }
+
+func TestForwardSearch(t *testing.T) {
+	history := NewHistory()
+	history.Add("aa")
+	history.Add("ab")
+	history.Add("ba")
+	history.Add("ac")
+
+	rs := NewReverseSearch(history)
+	rs.update("a")
+	assert.Equal(t, 3, rs.matchedIndex)
+
+	// Go back to older entries.
+	rs.reducePrefix()
+	rs.update("a")
+	rs.reducePrefix()
+	rs.update("a")
+	rs.reducePrefix()
+	rs.update("a")
+	assert.Equal(t, "aa", rs.matchedCmd)
+
+	// Switch the direction, the search continues from the match.
+	rs.reduceSuffix()
+	assert.Equal(t, searchForward, rs.direction)
+	rs.update("a")
+	assert.Equal(t, "ab", rs.matchedCmd)
+	assert.Equal(t, 1, rs.matchedIndex)
+
+	rs.update("ba")
+	assert.Equal(t, "ba", rs.matchedCmd)
+
+	// Search forward too many times.
+	for i := 0; i < 10; i++ {
+		rs.reduceSuffix()
+		rs.update("a")
+	}
+	assert.Equal(t, len(history.tmp)-1, rs.searchFromIndex)
+	assert.Equal(t, -1, rs.matchedIndex)
+	assert.Equal(t, "", rs.matchedCmd)
+}
+
+func TestSearchPrefixFormat(t *testing.T) {
+	rs := NewReverseSearch(NewHistory())
+	formats := SearchPrefixFormats{Reverse: "rev %s", FailedForward: "ffwd %s"}
+
+	assert.Equal(t, failSearchPrefixFmt, rs.prefixFormat(formats))
+	rs.direction = searchForward
+	assert.Equal(t, "ffwd %s", rs.prefixFormat(formats))
+	rs.matchedIndex = 0
+	assert.Equal(t, matchForwardSearchPrefixFmt, rs.prefixFormat(formats))
+	rs.direction = searchBackward
+	assert.Equal(t, "rev %s", rs.prefixFormat(formats))
+}
+
+func TestSearchMatcher(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		ignoreCase bool
+		useRegexp  bool
+		s          string
+		start      int
+		end        int
+	}{
+		{name: "plain", query: "fo", s: "a foo", start: 2, end: 4},
+		{name: "plain case", query: "FO", s: "a foo", start: -1, end: -1},
+		{name: "ignore case", query: "FO", ignoreCase: true, s: "a foo", start: 2, end: 4},
+		{name: "quoted", query: "a.c", ignoreCase: true, s: "abc a.c", start: 4, end: 7},
+		{name: "regexp", query: "o+$", useRegexp: true, s: "a foo", start: 3, end: 5},
+		{name: "regexp case", query: "^A", useRegexp: true, ignoreCase: true, s: "a", start: 0, end: 1},
+		{name: "invalid regexp", query: "(", useRegexp: true, s: "(", start: -1, end: -1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			match := newSearchMatcher(tc.query, tc.ignoreCase, tc.useRegexp)
+			start, end := match(tc.s)
+			assert.Equal(t, tc.start, start)
+			assert.Equal(t, tc.end, end)
+		})
+	}
+}
+
+func TestHistoryEntryInfo(t *testing.T) {
+	entry := HistoryEntry{Text: "cmd"}
+	assert.Equal(t, "", HistoryEntryInfo(entry))
+
+	entry.Status = "error"
+	assert.Equal(t, "error", HistoryEntryInfo(entry))
+
+	entry.Time = time.Date(2023, 7, 19, 10, 20, 30, 0, time.Local)
+	entry.Duration = 1500*time.Millisecond + 10*time.Microsecond
+	assert.Equal(t, "2023-07-19 10:20:30, 1.5s, error", HistoryEntryInfo(entry))
+}
@@ -0,0 +1,203 @@
+package prompt
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a part of the text found by a Tokenizer.
+type Token struct {
+	// Start and End are the positions of the first rune of the token and
+	// the rune after the last one in the text.
+	Start int
+	End   int
+	// Value is the text of the token without the quotes and the escapes.
+	Value string
+	// Quote is the quote character starting the token, 0 if it does not
+	// start with a quote.
+	Quote rune
+}
+
+// Tokenizer splits the text into tokens, which are completed and passed
+// by the word motions.
+type Tokenizer interface {
+	// Tokenize returns the tokens of the text in the order of appearance.
+	// A token is not terminated by the end of the text inside quotes.
+	Tokenize(text string) []Token
+	// Quote returns the text of a token with the value. The quote is used
+	// to quote the value if it is not 0. If complete is false, the value is
+	// a prefix, which may be continued, and the quote is not closed.
+	Quote(value string, quote rune, complete bool) string
+}
+
+// ShellTokenizer splits the text into the words separated by blanks like
+// a POSIX shell. Quoted strings and escaped characters do not separate words.
+type ShellTokenizer struct{}
+
+// shellSpecialCharacters are escaped in the unquoted words. The tilde is not
+// escaped to keep the home directory in the paths.
+const shellSpecialCharacters = " \t\n\\'\"`$&;|<>()*?[]#!{}"
+
+// Tokenize returns the words of the text.
+func (ShellTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	var token *Token
+	value := strings.Builder{}
+	var quote rune
+	escaped := false
+	pos := 0
+	for _, r := range text {
+		if token == nil && !unicode.IsSpace(r) {
+			token = &Token{Start: pos}
+			if r == '\'' || r == '"' {
+				token.Quote = r
+			}
+		}
+		switch {
+		case token == nil:
+		case escaped:
+			escaped = false
+			value.WriteRune(r)
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				value.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case unicode.IsSpace(r):
+			token.End, token.Value = pos, value.String()
+			tokens = append(tokens, *token)
+			token = nil
+			value.Reset()
+		default:
+			value.WriteRune(r)
+		}
+		pos++
+	}
+	if token != nil {
+		token.End, token.Value = pos, value.String()
+		tokens = append(tokens, *token)
+	}
+	return tokens
+}
+
+// Quote returns the value in the quotes or with the escaped special
+// characters if there is no quote.
+func (ShellTokenizer) Quote(value string, quote rune, complete bool) string {
+	sb := strings.Builder{}
+	switch quote {
+	case '\'':
+		sb.WriteRune(quote)
+		sb.WriteString(strings.Replace(value, `'`, `'\''`, -1))
+	case '"':
+		sb.WriteRune(quote)
+		for _, r := range value {
+			if strings.ContainsRune("\\\"$`", r) {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+		}
+	default:
+		for _, r := range value {
+			if strings.ContainsRune(shellSpecialCharacters, r) {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	}
+	if complete {
+		sb.WriteRune(quote)
+	}
+	return sb.String()
+}
+
+// LuaTokenizer splits the text into the Lua names, numbers and short string
+// literals, so the fields and the methods are separate tokens: "box",
+// "space", "x" and "select" in "box.space['x']:select".
+type LuaTokenizer struct{}
+
+// Tokenize returns the names, the numbers and the strings of the text.
+func (LuaTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"':
+			token := Token{Start: i, Quote: r}
+			value := strings.Builder{}
+			i++
+			for i < len(runes) && runes[i] != r && runes[i] != '\n' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					value.WriteRune(luaUnescape(runes[i]))
+				} else {
+					value.WriteRune(runes[i])
+				}
+				i++
+			}
+			if i < len(runes) && runes[i] == r {
+				i++
+			}
+			token.End, token.Value = i, value.String()
+			tokens = append(tokens, token)
+		case isLuaNameRune(r):
+			start := i
+			for i < len(runes) && isLuaNameRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Start: start, End: i, Value: string(runes[start:i])})
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// Quote returns the value as a string literal if the quote is not 0,
+// otherwise the value is returned as is.
+func (LuaTokenizer) Quote(value string, quote rune, complete bool) string {
+	if quote == 0 {
+		return value
+	}
+	sb := strings.Builder{}
+	sb.WriteRune(quote)
+	for _, r := range value {
+		switch r {
+		case '\\', quote:
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if complete {
+		sb.WriteRune(quote)
+	}
+	return sb.String()
+}
+
+// isLuaNameRune returns true if the rune is a part of a Lua name or number.
+func isLuaNameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// luaUnescape returns the rune of the Lua escape sequence with the rune.
+func luaUnescape(r rune) rune {
+	switch r {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	}
+	return r
+}
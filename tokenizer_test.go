@@ -0,0 +1,87 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellTokenizerTokenize(t *testing.T) {
+	scenarioTable := []struct {
+		text     string
+		expected []Token
+	}{
+		{text: "", expected: nil},
+		{text: "  ", expected: nil},
+		{text: "ls -l", expected: []Token{
+			{Start: 0, End: 2, Value: "ls"},
+			{Start: 3, End: 5, Value: "-l"},
+		}},
+		{text: `ls "my dir/fi`, expected: []Token{
+			{Start: 0, End: 2, Value: "ls"},
+			{Start: 3, End: 13, Value: "my dir/fi", Quote: '"'},
+		}},
+		{text: `cat 'a "b' c\ d "e\"f"g`, expected: []Token{
+			{Start: 0, End: 3, Value: "cat"},
+			{Start: 4, End: 10, Value: `a "b`, Quote: '\''},
+			{Start: 11, End: 15, Value: "c d"},
+			{Start: 16, End: 23, Value: `e"fg`, Quote: '"'},
+		}},
+		{text: `'a\' 日本`, expected: []Token{
+			{Start: 0, End: 4, Value: `a\`, Quote: '\''},
+			{Start: 5, End: 7, Value: "日本"},
+		}},
+		{text: `a\`, expected: []Token{{Start: 0, End: 2, Value: "a"}}},
+	}
+
+	for _, s := range scenarioTable {
+		t.Run(s.text, func(t *testing.T) {
+			assert.Equal(t, s.expected, ShellTokenizer{}.Tokenize(s.text))
+		})
+	}
+}
+
+func TestShellTokenizerQuote(t *testing.T) {
+	tokenizer := ShellTokenizer{}
+	assert.Equal(t, `my\ dir/\$x`, tokenizer.Quote("my dir/$x", 0, true))
+	assert.Equal(t, `"my dir/\$x"`, tokenizer.Quote("my dir/$x", '"', true))
+	assert.Equal(t, `"my dir`, tokenizer.Quote("my dir", '"', false))
+	assert.Equal(t, `'it'\''s'`, tokenizer.Quote("it's", '\'', true))
+}
+
+func TestLuaTokenizerTokenize(t *testing.T) {
+	scenarioTable := []struct {
+		text     string
+		expected []Token
+	}{
+		{text: "", expected: nil},
+		{text: "box.space['x']:", expected: []Token{
+			{Start: 0, End: 3, Value: "box"},
+			{Start: 4, End: 9, Value: "space"},
+			{Start: 10, End: 13, Value: "x", Quote: '\''},
+		}},
+		{text: `box.space["te`, expected: []Token{
+			{Start: 0, End: 3, Value: "box"},
+			{Start: 4, End: 9, Value: "space"},
+			{Start: 10, End: 13, Value: "te", Quote: '"'},
+		}},
+		{text: `f("a\"b\n", _x1)`, expected: []Token{
+			{Start: 0, End: 1, Value: "f"},
+			{Start: 2, End: 10, Value: "a\"b\n", Quote: '"'},
+			{Start: 12, End: 15, Value: "_x1"},
+		}},
+	}
+
+	for _, s := range scenarioTable {
+		t.Run(s.text, func(t *testing.T) {
+			assert.Equal(t, s.expected, LuaTokenizer{}.Tokenize(s.text))
+		})
+	}
+}
+
+func TestLuaTokenizerQuote(t *testing.T) {
+	tokenizer := LuaTokenizer{}
+	assert.Equal(t, "space", tokenizer.Quote("space", 0, true))
+	assert.Equal(t, `'it\'s'`, tokenizer.Quote("it's", '\'', true))
+	assert.Equal(t, `"a\\b\n`, tokenizer.Quote("a\\b\n", '"', false))
+}